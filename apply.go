@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"strings"
+	"testing"
+)
+
+// ApplyEnv is the name of the environment variable set by Apply, for
+// the duration of the test, when it applies patches that touch
+// process-global state.  Setting it with the test's Setenv method is
+// what marks the test as unable to run in parallel.  As it is set in
+// the process environment, it is visible to the code under test and
+// is inherited by any subprocesses the test starts, including the
+// child processes started by RunIsolated.
+const ApplyEnv = "PATCHER_GLOBAL_PATCHES"
+
+// GlobalPatcher is implemented by patchers that declare whether they
+// touch process-global state, such as package variables, environment
+// variables, the default logger, or the working directory.  Patchers
+// that do not implement GlobalPatcher are assumed to touch
+// process-global state.
+type GlobalPatcher interface {
+	Patcher
+
+	// Global returns true if the patcher touches process-global
+	// state.
+	Global() bool
+}
+
+// IsGlobal tests whether a patcher touches process-global state.
+func IsGlobal(patch Patcher) bool {
+	if gp, ok := patch.(GlobalPatcher); ok {
+		return gp.Global()
+	}
+
+	return true
+}
+
+// Apply installs patches for the duration of a test, restoring them
+// when the test and its subtests complete.  If any of the patches
+// touch process-global state, Apply fails the test if the test or
+// any of its ancestors is running in parallel, since tests running in
+// parallel with it would observe the patches; it also causes a later
+// call to the test's Parallel method to panic.  This is the same
+// check the Setenv method of testing.T performs; it is done by setting
+// the ApplyEnv environment variable for the duration of the test,
+// which is visible to the code under test and to subprocesses.  The
+// PatchMaster containing the patches is returned.  It could be used in
+// a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		Apply(t, SetVar(&readFile, func(filename string) ([]byte, error) {
+//			return []byte("hello"), nil
+//		}))
+//
+//		err := DoSomething("some-filename")
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func Apply(t testing.TB, patches ...Patcher) *PatchMaster {
+	t.Helper()
+
+	pm := NewPatchMaster(patches...)
+	if pm.Global() && !denyParallel(t) {
+		return nil
+	}
+
+	t.Cleanup(func() {
+		pm.Restore()
+	})
+	pm.Install()
+
+	return pm
+}
+
+// parallelPanic tests whether a value recovered from a panic in the
+// test's Setenv method is the panic it raises when the test or one of
+// its ancestors is running in parallel.
+func parallelPanic(panicData interface{}) bool {
+	msg, ok := panicData.(string)
+
+	return ok && strings.HasPrefix(msg, "testing: ") && strings.Contains(msg, "t.Parallel")
+}
+
+// denyParallel marks the test as unable to run in parallel.  If the
+// test or any of its ancestors is already running in parallel, it
+// fails the test and returns false.  Any other panic from the test's
+// Setenv method is propagated.
+func denyParallel(t testing.TB) (ok bool) {
+	t.Helper()
+
+	defer func() {
+		if panicData := recover(); panicData != nil {
+			if !parallelPanic(panicData) {
+				panic(panicData)
+			}
+			t.Fatalf("cannot apply patches that touch process-global state in a parallel test or a subtest of one, since tests running in parallel would observe them: %v", panicData)
+			ok = false
+		}
+	}()
+	t.Setenv(ApplyEnv, "1")
+
+	return true
+}
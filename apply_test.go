@@ -0,0 +1,165 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type localPatcher struct {
+	MockPatcher
+}
+
+func (lp *localPatcher) Global() bool {
+	return false
+}
+
+func TestIsGlobal(t *testing.T) {
+	assert.True(t, IsGlobal(&MockPatcher{}))
+	assert.False(t, IsGlobal(&localPatcher{}))
+}
+
+func TestBuiltinPatchersGlobal(t *testing.T) {
+	for _, patch := range []GlobalPatcher{
+		&VariableSetter{},
+		&EnvPatcher{},
+		&LogPatcher{},
+		&ArgsPatcher{},
+		&DirPatcher{},
+		&ResolverPatcher{},
+		&HTTPReplayPatcher{},
+		&ServerPatcher{},
+		&FaultPatcher{},
+		&DelayPatcher{},
+		&TimesPatcher{},
+		&FieldSetter{},
+		&MapEntryPatcher{},
+		&SlicePatcher{},
+		&SnapshotPatcher{},
+	} {
+		assert.True(t, patch.Global(), "%T", patch)
+	}
+}
+
+func TestPatchMasterGlobal(t *testing.T) {
+	assert.False(t, NewPatchMaster().Global())
+	assert.False(t, NewPatchMaster(&localPatcher{}).Global())
+	assert.True(t, NewPatchMaster(&localPatcher{}, &MockPatcher{}).Global())
+}
+
+func TestContextPatcherGlobal(t *testing.T) {
+	assert.False(t, newContextPatcher(context.Background(), 0, &localPatcher{}).Global())
+	assert.True(t, newContextPatcher(context.Background(), 0, &MockPatcher{}).Global())
+}
+
+func TestApply(t *testing.T) {
+	variable := "unpatched"
+
+	t.Run("apply", func(t *testing.T) {
+		pm := Apply(t, SetVar(&variable, "patched"))
+
+		assert.NotNil(t, pm)
+		assert.Equal(t, "patched", variable)
+		assert.Equal(t, "1", os.Getenv(ApplyEnv))
+		assert.Panics(t, func() {
+			t.Parallel()
+		})
+	})
+
+	assert.Equal(t, "unpatched", variable)
+}
+
+func TestApplyParallel(t *testing.T) {
+	variable := "unpatched"
+
+	t.Run("parallel", func(t *testing.T) {
+		t.Parallel()
+		tb := &fakeTB{TB: t}
+
+		pm := Apply(tb, SetVar(&variable, "patched"))
+
+		assert.Nil(t, pm)
+		assert.Contains(t, tb.fatal, "cannot apply patches that touch process-global state in a parallel test")
+		assert.Equal(t, "unpatched", variable)
+	})
+}
+
+func TestApplyParallelAncestor(t *testing.T) {
+	variable := "unpatched"
+
+	t.Run("parallel", func(t *testing.T) {
+		t.Parallel()
+
+		t.Run("child", func(t *testing.T) {
+			tb := &fakeTB{TB: t}
+
+			pm := Apply(tb, SetVar(&variable, "patched"))
+
+			assert.Nil(t, pm)
+			assert.Contains(t, tb.fatal, "cannot apply patches that touch process-global state in a parallel test")
+			assert.Equal(t, "unpatched", variable)
+		})
+	})
+}
+
+type setenvPanicTB struct {
+	fakeTB
+	panicData interface{}
+}
+
+func (tb *setenvPanicTB) Setenv(key, value string) {
+	panic(tb.panicData)
+}
+
+func TestDenyParallelOtherPanic(t *testing.T) {
+	tb := &setenvPanicTB{fakeTB: fakeTB{TB: t}, panicData: "some other panic"}
+
+	assert.PanicsWithValue(t, "some other panic", func() {
+		denyParallel(tb)
+	})
+	assert.Equal(t, "", tb.fatal)
+}
+
+func TestDenyParallelParallelPanic(t *testing.T) {
+	tb := &setenvPanicTB{fakeTB: fakeTB{TB: t}, panicData: "testing: t.Setenv called after t.Parallel; cannot set environment variables in parallel tests"}
+
+	result := denyParallel(tb)
+
+	assert.False(t, result)
+	assert.Contains(t, tb.fatal, "cannot apply patches that touch process-global state in a parallel test")
+}
+
+func TestApplyParallelLocal(t *testing.T) {
+	patch := &localPatcher{}
+	patch.On("Install").Once()
+	patch.On("Restore").Once()
+
+	t.Run("parallel", func(t *testing.T) {
+		t.Parallel()
+
+		pm := Apply(t, patch)
+
+		assert.NotNil(t, pm)
+		patch.AssertCalled(t, "Install")
+	})
+
+	t.Cleanup(func() {
+		patch.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"flag"
+	"io"
+	"os"
+	"sync"
+)
+
+// ArgsOption is an option that may be passed to Args.
+type ArgsOption func(ap *ArgsPatcher)
+
+// FlagErrorHandling is an ArgsOption that sets the error handling of
+// the fresh flag.FlagSet.  The default is flag.ContinueOnError, so
+// that a parse error does not exit the test binary.
+func FlagErrorHandling(handling flag.ErrorHandling) ArgsOption {
+	return func(ap *ArgsPatcher) {
+		ap.handling = handling
+	}
+}
+
+// FlagOutput is an ArgsOption that sets the destination for usage and
+// error messages from the fresh flag.FlagSet.
+func FlagOutput(output io.Writer) ArgsOption {
+	return func(ap *ArgsPatcher) {
+		ap.output = output
+	}
+}
+
+// ArgsPatcher is a patcher that sets os.Args and installs a fresh
+// flag.FlagSet as flag.CommandLine, allowing "main"-style functions
+// that define and parse flags to be tested, even repeatedly.
+type ArgsPatcher struct {
+	lock        sync.Mutex
+	args        []string
+	handling    flag.ErrorHandling
+	output      io.Writer
+	origArgs    []string
+	origCommand *flag.FlagSet
+	origUsage   func()
+	applied     bool
+}
+
+// Args constructs an ArgsPatcher, storing the desired value of
+// os.Args, including the program name.  When installed, a fresh
+// flag.FlagSet named after the program is installed as
+// flag.CommandLine; the original os.Args, flag.CommandLine, and
+// flag.Usage, including any flags defined on and parsed by the
+// original flag.CommandLine, are put back when the patch is restored.
+// Since flag.Parse expects os.Args to contain the program name, Args
+// will panic if no arguments are passed.  It could be used in a test
+// function like so:
+//
+//	func TestMain(t *testing.T) {
+//		output := &bytes.Buffer{}
+//		defer Args("prog", "-v", "input").Install().Restore()
+//		defer Log(output).Install().Restore()
+//
+//		main()
+//
+//		if output.String() != "processed input" {
+//			t.Fail("failed to process input!")
+//		}
+//	}
+func Args(args ...string) *ArgsPatcher {
+	if len(args) == 0 {
+		panic("cannot patch os.Args without a program name!")
+	}
+
+	return &ArgsPatcher{
+		args:     append([]string{}, args...),
+		handling: flag.ContinueOnError,
+	}
+}
+
+// With applies options to the ArgsPatcher.  For convenience, it
+// returns the ArgsPatcher.
+func (ap *ArgsPatcher) With(opts ...ArgsOption) *ArgsPatcher {
+	for _, opt := range opts {
+		opt(ap)
+	}
+
+	return ap
+}
+
+// FlagSet returns the fresh flag.FlagSet installed as
+// flag.CommandLine.  It returns nil if the patch is not installed.
+func (ap *ArgsPatcher) FlagSet() *flag.FlagSet {
+	ap.lock.Lock()
+	defer ap.lock.Unlock()
+
+	if !ap.applied {
+		return nil
+	}
+
+	return flag.CommandLine
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (ap *ArgsPatcher) Install() Patcher {
+	ap.lock.Lock()
+	defer ap.lock.Unlock()
+
+	// Be idempotent
+	if ap.applied {
+		return ap
+	}
+
+	// Save the current values
+	ap.origArgs = os.Args
+	ap.origCommand = flag.CommandLine
+	ap.origUsage = flag.Usage
+
+	// Construct the new flag set
+	fs := flag.NewFlagSet(ap.args[0], ap.handling)
+	if ap.output != nil {
+		fs.SetOutput(ap.output)
+	}
+	fs.Usage = func() { flag.Usage() }
+
+	// Set the new values
+	os.Args = append([]string{}, ap.args...)
+	flag.CommandLine = fs
+	ap.applied = true
+
+	return ap
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (ap *ArgsPatcher) Restore() Patcher {
+	ap.lock.Lock()
+	defer ap.lock.Unlock()
+
+	// Be idempotent
+	if !ap.applied {
+		return ap
+	}
+
+	// Restore the original values
+	os.Args = ap.origArgs
+	flag.CommandLine = ap.origCommand
+	flag.Usage = ap.origUsage
+	ap.applied = false
+
+	return ap
+}
+
+// Global implements GlobalPatcher.  An ArgsPatcher always touches
+// process-global state, since it replaces os.Args and
+// flag.CommandLine.
+func (ap *ArgsPatcher) Global() bool {
+	return true
+}
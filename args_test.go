@@ -0,0 +1,145 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgsPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*Patcher)(nil), &ArgsPatcher{})
+}
+
+func TestArgs(t *testing.T) {
+	args := []string{"prog", "-v"}
+
+	result := Args(args...)
+	args[1] = "-q"
+
+	assert.Equal(t, &ArgsPatcher{
+		args:     []string{"prog", "-v"},
+		handling: flag.ContinueOnError,
+	}, result)
+}
+
+func TestArgsPatcherWith(t *testing.T) {
+	output := &bytes.Buffer{}
+	ap := Args("prog")
+
+	result := ap.With(FlagErrorHandling(flag.PanicOnError), FlagOutput(output))
+
+	assert.Same(t, ap, result)
+	assert.Equal(t, flag.PanicOnError, ap.handling)
+	assert.Same(t, output, ap.output)
+}
+
+func TestArgsPatcherInstallRestore(t *testing.T) {
+	origArgs := os.Args
+	origCommand := flag.CommandLine
+	output := &bytes.Buffer{}
+	ap := Args("prog", "-bogus").With(FlagOutput(output))
+
+	for i := 0; i < 2; i++ {
+		result := ap.Install()
+
+		assert.Same(t, ap, result)
+		assert.True(t, ap.applied)
+		assert.Equal(t, []string{"prog", "-bogus"}, os.Args)
+		assert.NotSame(t, origCommand, flag.CommandLine)
+		assert.Same(t, flag.CommandLine, ap.FlagSet())
+		assert.Equal(t, "prog", flag.CommandLine.Name())
+		assert.Equal(t, flag.ContinueOnError, flag.CommandLine.ErrorHandling())
+		flag.Bool("verbose", false, "Verbose output")
+		err := flag.CommandLine.Parse(os.Args[1:])
+		assert.Error(t, err)
+		assert.Contains(t, output.String(), "Usage of prog:")
+		assert.Contains(t, output.String(), "-verbose")
+
+		result = ap.Restore()
+
+		assert.Same(t, ap, result)
+		assert.False(t, ap.applied)
+		assert.Nil(t, ap.FlagSet())
+		assert.Equal(t, origArgs, os.Args)
+		assert.Same(t, origCommand, flag.CommandLine)
+		assert.Nil(t, flag.Lookup("verbose"))
+		output.Reset()
+	}
+}
+
+func TestArgsEmpty(t *testing.T) {
+	assert.PanicsWithValue(t, "cannot patch os.Args without a program name!", func() {
+		Args()
+	})
+}
+
+func TestArgsPatcherRestoreUsage(t *testing.T) {
+	origUsage := flag.Usage
+	called := false
+	ap := Args("prog")
+
+	ap.Install()
+	flag.Usage = func() { called = true }
+	flag.CommandLine.Usage()
+	ap.Restore()
+
+	assert.True(t, called)
+	assert.Equal(t, reflectPointer(origUsage), reflectPointer(flag.Usage))
+}
+
+func TestArgsPatcherInstallIdempotent(t *testing.T) {
+	origCommand := flag.CommandLine
+	ap := Args("prog")
+	ap.applied = true
+
+	result := ap.Install()
+
+	assert.Same(t, ap, result)
+	assert.Same(t, origCommand, flag.CommandLine)
+	assert.True(t, ap.applied)
+}
+
+func TestArgsPatcherRestoreIdempotent(t *testing.T) {
+	origArgs := os.Args
+	ap := Args("prog")
+
+	result := ap.Restore()
+
+	assert.Same(t, ap, result)
+	assert.Equal(t, origArgs, os.Args)
+	assert.False(t, ap.applied)
+}
+
+func reflectPointer(fn func()) uintptr {
+	return reflect.ValueOf(fn).Pointer()
+}
+
+func TestArgsPatcherConcurrent(t *testing.T) {
+	origArgs := os.Args
+	origCommand := flag.CommandLine
+	ap := Args("prog", "arg")
+
+	hammer(ap)
+
+	assert.Equal(t, origArgs, os.Args)
+	assert.Same(t, origCommand, flag.CommandLine)
+	assert.Nil(t, ap.FlagSet())
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"os"
+	"sync"
+)
+
+// DirPatcher is a patcher that, given a directory, will change the
+// current working directory to that directory.
+type DirPatcher struct {
+	lock     sync.Mutex
+	dir      string
+	original string
+	applied  bool
+}
+
+// Patch points for testing the routines in this file.
+var (
+	chdir = os.Chdir
+	getwd = os.Getwd
+)
+
+// Chdir constructs a DirPatcher, storing the desired working
+// directory.  A relative directory is interpreted relative to the
+// working directory at the time the patch is installed.  It will
+// panic if the working directory cannot be changed.  It could be used
+// in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer Chdir("testdata").Install().Restore()
+//
+//		err := DoSomething("some-filename")
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func Chdir(dir string) *DirPatcher {
+	return &DirPatcher{
+		dir: dir,
+	}
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (dp *DirPatcher) Install() Patcher {
+	dp.lock.Lock()
+	defer dp.lock.Unlock()
+
+	// Be idempotent
+	if dp.applied {
+		return dp
+	}
+
+	// Save the current working directory
+	original, err := getwd()
+	if err != nil {
+		panic(err)
+	}
+	dp.original = original
+
+	// Change to the desired directory
+	if err := chdir(dp.dir); err != nil {
+		panic(err)
+	}
+	dp.applied = true
+
+	return dp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (dp *DirPatcher) Restore() Patcher {
+	dp.lock.Lock()
+	defer dp.lock.Unlock()
+
+	// Be idempotent
+	if !dp.applied {
+		return dp
+	}
+
+	// Change back to the original directory
+	if err := chdir(dp.original); err != nil {
+		panic(err)
+	}
+	dp.applied = false
+
+	return dp
+}
+
+// Global implements GlobalPatcher.  The working directory is shared
+// by the whole process, so a DirPatcher always touches process-global
+// state.
+func (dp *DirPatcher) Global() bool {
+	return true
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*Patcher)(nil), &DirPatcher{})
+}
+
+func TestChdir(t *testing.T) {
+	result := Chdir("/some/dir")
+
+	assert.Equal(t, &DirPatcher{dir: "/some/dir"}, result)
+}
+
+func TestDirPatcherInstall(t *testing.T) {
+	dirs := []string{}
+	defer NewPatchMaster(
+		SetVar(&getwd, func() (string, error) {
+			return "/orig/dir", nil
+		}),
+		SetVar(&chdir, func(dir string) error {
+			dirs = append(dirs, dir)
+			return nil
+		}),
+	).Install().Restore()
+	dp := Chdir("/some/dir")
+
+	result := dp.Install()
+
+	assert.Same(t, dp, result)
+	assert.Equal(t, "/orig/dir", dp.original)
+	assert.True(t, dp.applied)
+	assert.Equal(t, []string{"/some/dir"}, dirs)
+}
+
+func TestDirPatcherInstallIdempotent(t *testing.T) {
+	dirs := []string{}
+	defer NewPatchMaster(
+		SetVar(&getwd, func() (string, error) {
+			return "/orig/dir", nil
+		}),
+		SetVar(&chdir, func(dir string) error {
+			dirs = append(dirs, dir)
+			return nil
+		}),
+	).Install().Restore()
+	dp := Chdir("/some/dir")
+	dp.applied = true
+
+	result := dp.Install()
+
+	assert.Same(t, dp, result)
+	assert.Equal(t, "", dp.original)
+	assert.True(t, dp.applied)
+	assert.Equal(t, []string{}, dirs)
+}
+
+func TestDirPatcherInstallGetwdFails(t *testing.T) {
+	defer NewPatchMaster(
+		SetVar(&getwd, func() (string, error) {
+			return "", assert.AnError
+		}),
+		SetVar(&chdir, func(dir string) error {
+			t.Fail()
+			return nil
+		}),
+	).Install().Restore()
+	dp := Chdir("/some/dir")
+
+	assert.PanicsWithValue(t, assert.AnError, func() {
+		dp.Install()
+	})
+	assert.False(t, dp.applied)
+}
+
+func TestDirPatcherInstallChdirFails(t *testing.T) {
+	defer NewPatchMaster(
+		SetVar(&getwd, func() (string, error) {
+			return "/orig/dir", nil
+		}),
+		SetVar(&chdir, func(dir string) error {
+			return assert.AnError
+		}),
+	).Install().Restore()
+	dp := Chdir("/some/dir")
+
+	assert.PanicsWithValue(t, assert.AnError, func() {
+		dp.Install()
+	})
+	assert.False(t, dp.applied)
+}
+
+func TestDirPatcherRestore(t *testing.T) {
+	dirs := []string{}
+	defer SetVar(&chdir, func(dir string) error {
+		dirs = append(dirs, dir)
+		return nil
+	}).Install().Restore()
+	dp := &DirPatcher{dir: "/some/dir", original: "/orig/dir", applied: true}
+
+	result := dp.Restore()
+
+	assert.Same(t, dp, result)
+	assert.False(t, dp.applied)
+	assert.Equal(t, []string{"/orig/dir"}, dirs)
+}
+
+func TestDirPatcherRestoreIdempotent(t *testing.T) {
+	dirs := []string{}
+	defer SetVar(&chdir, func(dir string) error {
+		dirs = append(dirs, dir)
+		return nil
+	}).Install().Restore()
+	dp := &DirPatcher{dir: "/some/dir", original: "/orig/dir"}
+
+	result := dp.Restore()
+
+	assert.Same(t, dp, result)
+	assert.False(t, dp.applied)
+	assert.Equal(t, []string{}, dirs)
+}
+
+func TestDirPatcherRestoreFails(t *testing.T) {
+	defer SetVar(&chdir, func(dir string) error {
+		return assert.AnError
+	}).Install().Restore()
+	dp := &DirPatcher{dir: "/some/dir", original: "/orig/dir", applied: true}
+
+	assert.PanicsWithValue(t, assert.AnError, func() {
+		dp.Restore()
+	})
+	assert.True(t, dp.applied)
+}
+
+func TestDirPatcherConcurrent(t *testing.T) {
+	original, err := os.Getwd()
+	require.NoError(t, err)
+
+	hammer(Chdir(t.TempDir()))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, original, wd)
+}
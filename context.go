@@ -0,0 +1,190 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ContextPatcher is a patcher that wraps another patcher, restoring
+// it automatically when a context is done.  Its Install and Restore
+// methods are safe to call concurrently, so an automatic restore may
+// race safely with an explicit call to Restore.  The wrapped patcher
+// must only be restored through the ContextPatcher.
+type ContextPatcher struct {
+	lock    sync.Mutex
+	parent  context.Context
+	timeout time.Duration
+	patch   Patcher
+	stop    chan struct{}
+	done    chan struct{}
+	applied bool
+}
+
+// newContextPatcher constructs a ContextPatcher.
+func newContextPatcher(ctx context.Context, timeout time.Duration, patch Patcher) *ContextPatcher {
+	done := make(chan struct{})
+	close(done)
+
+	return &ContextPatcher{
+		parent:  ctx,
+		timeout: timeout,
+		patch:   patch,
+		done:    done,
+	}
+}
+
+// InstallContext constructs a ContextPatcher and installs it.  The
+// wrapped patcher is restored when the context is done, or when the
+// ContextPatcher is explicitly restored, whichever comes first.  It
+// could be used in a test function like so:
+//
+//	func TestServer(t *testing.T) {
+//		ctx, cancel := context.WithCancel(context.Background())
+//		defer cancel()
+//		cp := InstallContext(ctx, SetVar(&readFile, func(filename string) ([]byte, error) {
+//			return []byte("hello"), nil
+//		}))
+//		defer cp.Restore()
+//
+//		go Serve(ctx)
+//
+//		// Do some tests, then shut down the server
+//		cancel()
+//		cp.Wait()
+//	}
+func InstallContext(ctx context.Context, patch Patcher) *ContextPatcher {
+	cp := newContextPatcher(ctx, 0, patch)
+	cp.Install()
+
+	return cp
+}
+
+// Timeout constructs a ContextPatcher and installs it.  The wrapped
+// patcher is restored after the specified duration, or when the
+// ContextPatcher is explicitly restored, whichever comes first; the
+// duration is measured from each installation.  It could be used in
+// a test function like so:
+//
+//	func TestRetry(t *testing.T) {
+//		defer Timeout(100*time.Millisecond, SetVar(&readFile, func(filename string) ([]byte, error) {
+//			return nil, errors.New("temporary failure")
+//		})).Restore()
+//
+//		err := DoSomethingWithRetry("some-filename")
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func Timeout(d time.Duration, patch Patcher) *ContextPatcher {
+	cp := newContextPatcher(context.Background(), d, patch)
+	cp.Install()
+
+	return cp
+}
+
+// Done returns a channel that is closed when the wrapped patcher has
+// been restored.  If the patch is not installed, the returned channel
+// is already closed.
+func (cp *ContextPatcher) Done() <-chan struct{} {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	return cp.done
+}
+
+// Wait waits until the wrapped patcher has been restored.
+func (cp *ContextPatcher) Wait() {
+	<-cp.Done()
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (cp *ContextPatcher) Install() Patcher {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	// Be idempotent
+	if cp.applied {
+		return cp
+	}
+
+	// Install the wrapped patcher
+	cp.patch.Install()
+	cp.stop = make(chan struct{})
+	cp.done = make(chan struct{})
+	cp.applied = true
+
+	// Watch for the context to be done
+	ctx, cancel := cp.parent, context.CancelFunc(func() {})
+	if cp.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cp.timeout)
+	}
+	go cp.watch(ctx, cancel, cp.stop)
+
+	return cp
+}
+
+// watch waits for the context to be done, then restores the wrapped
+// patcher, unless the installation identified by stop has already
+// been restored.
+func (cp *ContextPatcher) watch(ctx context.Context, cancel context.CancelFunc, stop chan struct{}) {
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+		cp.lock.Lock()
+		defer cp.lock.Unlock()
+
+		if cp.applied && cp.stop == stop {
+			cp.restore()
+		}
+
+	case <-stop:
+	}
+}
+
+// restore restores the wrapped patcher.  It must be called with the
+// lock held.
+func (cp *ContextPatcher) restore() {
+	cp.patch.Restore()
+	cp.applied = false
+	close(cp.stop)
+	close(cp.done)
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (cp *ContextPatcher) Restore() Patcher {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	// Be idempotent
+	if cp.applied {
+		cp.restore()
+	}
+
+	return cp
+}
+
+// Global implements GlobalPatcher.  A ContextPatcher touches
+// process-global state if the wrapped patcher does.
+func (cp *ContextPatcher) Global() bool {
+	return IsGlobal(cp.patch)
+}
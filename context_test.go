@@ -0,0 +1,187 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*Patcher)(nil), &ContextPatcher{})
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestInstallContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	variable := "unpatched"
+
+	cp := InstallContext(ctx, SetVar(&variable, "patched"))
+	defer cp.Restore()
+
+	assert.Equal(t, "patched", variable)
+	assert.True(t, cp.applied)
+	assert.False(t, isClosed(cp.Done()))
+
+	cancel()
+	cp.Wait()
+
+	assert.Equal(t, "unpatched", variable)
+	assert.False(t, cp.applied)
+	assert.True(t, isClosed(cp.Done()))
+}
+
+func TestTimeout(t *testing.T) {
+	variable := "unpatched"
+
+	cp := Timeout(10*time.Millisecond, SetVar(&variable, "patched"))
+	defer cp.Restore()
+
+	assert.Equal(t, "patched", variable)
+	assert.Equal(t, 10*time.Millisecond, cp.timeout)
+
+	select {
+	case <-cp.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout did not restore the patch")
+	}
+
+	assert.Equal(t, "unpatched", variable)
+	assert.False(t, cp.applied)
+}
+
+func TestContextPatcherDoneUninstalled(t *testing.T) {
+	cp := newContextPatcher(context.Background(), 0, &MockPatcher{})
+
+	assert.True(t, isClosed(cp.Done()))
+	cp.Wait()
+}
+
+func TestContextPatcherInstallIdempotent(t *testing.T) {
+	patch := &MockPatcher{}
+	patch.On("Install").Once()
+	patch.On("Restore").Once()
+	cp := newContextPatcher(context.Background(), 0, patch)
+
+	assert.Same(t, cp, cp.Install())
+	done := cp.Done()
+	assert.Same(t, cp, cp.Install())
+
+	assert.Equal(t, done, cp.Done())
+	cp.Restore()
+	patch.AssertExpectations(t)
+}
+
+func TestContextPatcherRestore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	patch := &MockPatcher{}
+	patch.On("Install").Once()
+	patch.On("Restore").Once()
+	cp := InstallContext(ctx, patch)
+	stop := cp.stop
+
+	result := cp.Restore()
+
+	assert.Same(t, cp, result)
+	assert.False(t, cp.applied)
+	assert.True(t, isClosed(cp.Done()))
+	assert.True(t, isClosed(stop))
+	cancel()
+	patch.AssertExpectations(t)
+}
+
+func TestContextPatcherRestoreIdempotent(t *testing.T) {
+	patch := &MockPatcher{}
+	cp := newContextPatcher(context.Background(), 0, patch)
+
+	result := cp.Restore()
+
+	assert.Same(t, cp, result)
+	assert.False(t, cp.applied)
+	patch.AssertExpectations(t)
+}
+
+func TestContextPatcherReinstall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	variable := "unpatched"
+	cp := InstallContext(ctx, SetVar(&variable, "patched"))
+	first := cp.Done()
+	cp.Restore()
+
+	cp.Install()
+
+	assert.Equal(t, "patched", variable)
+	assert.True(t, isClosed(first))
+	assert.False(t, isClosed(cp.Done()))
+	cancel()
+	cp.Wait()
+	assert.Equal(t, "unpatched", variable)
+}
+
+func TestContextPatcherStaleWatcher(t *testing.T) {
+	variable := "unpatched"
+	cp := newContextPatcher(context.Background(), 0, SetVar(&variable, "patched"))
+	cp.Install()
+	stale := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cp.watch(ctx, func() {}, stale)
+
+	assert.Equal(t, "patched", variable)
+	assert.True(t, cp.applied)
+	cp.Restore()
+}
+
+func TestContextPatcherRace(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		patch := &MockPatcher{}
+		patch.On("Install").Once()
+		patch.On("Restore").Once()
+		cp := InstallContext(ctx, patch)
+
+		wg := &sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cancel()
+		}()
+		go func() {
+			defer wg.Done()
+			cp.Restore()
+		}()
+		wg.Wait()
+		cp.Wait()
+
+		assert.False(t, cp.applied)
+		patch.AssertExpectations(t)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Sleep is the function used by DelayPatcher to wait.  It waits for
+// the specified duration, returning nil, or until the context is
+// done, returning the context's error.  Tests may patch it, e.g., with
+// SetVar, to substitute a fake clock and keep tests fast.
+var Sleep = sleepContext
+
+// sleepContext is the default implementation of Sleep.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DelayDistribution is a function that selects the delay to add to a
+// call.  It is passed the call number, starting at 1.
+type DelayDistribution func(call int) time.Duration
+
+// FixedDelay is a DelayDistribution that adds the same delay to every
+// call.
+func FixedDelay(d time.Duration) DelayDistribution {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// RandomDelay is a DelayDistribution that adds a delay chosen
+// uniformly from the range [low, high).  The random number generator
+// is seeded with the specified seed, so the delays are reproducible.
+func RandomDelay(low, high time.Duration, seed int64) DelayDistribution {
+	lock := &sync.Mutex{}
+	rng := rand.New(rand.NewSource(seed)) //nolint:gosec // reproducible, not secure
+
+	return func(int) time.Duration {
+		if high <= low {
+			return low
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		return low + time.Duration(rng.Int63n(int64(high-low)))
+	}
+}
+
+// ScriptedDelay is a DelayDistribution that adds the specified delays
+// to successive calls.  Once the script is exhausted, the last delay
+// is repeated; an empty script adds no delay.
+func ScriptedDelay(delays ...time.Duration) DelayDistribution {
+	return func(call int) time.Duration {
+		switch {
+		case len(delays) == 0:
+			return 0
+		case call > len(delays):
+			return delays[len(delays)-1]
+		default:
+			return delays[call-1]
+		}
+	}
+}
+
+// DelayPatcher is a patcher that, given a pointer to a function
+// variable, wraps the function to add a delay before each call.
+type DelayPatcher struct {
+	lock     sync.Mutex
+	variable reflect.Value
+	dist     DelayDistribution
+	errIdx   int
+	hasCtx   bool
+	original reflect.Value
+	calls    int
+	delays   []time.Duration
+	applied  bool
+}
+
+// Delay constructs a DelayPatcher, storing the function variable and
+// the distribution of delays.  While installed, each call to the
+// function waits for a delay selected by the distribution, using
+// Sleep, before calling the original function.  If the first
+// parameter of the function is a context.Context, the wait ends early
+// if the context is done; the call then returns the context's error,
+// if the function has an error return value, and zero values
+// otherwise, without calling the original function.  The call count
+// starts over each time the patch is installed.  It will panic if the
+// variable is not a function variable or if the distribution is nil.
+// It could be used in a test function like so:
+//
+//	func TestDoSomethingTimeout(t *testing.T) {
+//		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+//		defer cancel()
+//		defer Delay(&fetch, FixedDelay(time.Second)).Install().Restore()
+//
+//		err := DoSomething(ctx)
+//
+//		if !errors.Is(err, context.DeadlineExceeded) {
+//			t.Fail("failed to time out!")
+//		}
+//	}
+func Delay(variable interface{}, dist DelayDistribution) *DelayPatcher {
+	// Select the variable and validate it's a function variable
+	varReflect := reflect.ValueOf(variable)
+	if varReflect.Kind() != reflect.Ptr || varReflect.Elem().Kind() != reflect.Func {
+		panic("cannot add delay to variable passed to Delay!")
+	}
+	if dist == nil {
+		panic("cannot use nil distribution passed to Delay!")
+	}
+	v := varReflect.Elem()
+	typ := v.Type()
+
+	return &DelayPatcher{
+		variable: v,
+		dist:     dist,
+		errIdx:   errorIndex(typ),
+		hasCtx:   typ.NumIn() > 0 && typ.In(0).Implements(contextType),
+	}
+}
+
+// Delays returns a list of the delays added to calls since the patch
+// was last installed.
+func (dp *DelayPatcher) Delays() []time.Duration {
+	dp.lock.Lock()
+	defer dp.lock.Unlock()
+
+	return append([]time.Duration(nil), dp.delays...)
+}
+
+// selectDelay counts a call and selects the delay to add to it.
+func (dp *DelayPatcher) selectDelay() (time.Duration, reflect.Value) {
+	dp.lock.Lock()
+	defer dp.lock.Unlock()
+
+	dp.calls++
+	d := dp.dist(dp.calls)
+	dp.delays = append(dp.delays, d)
+
+	return d, dp.original
+}
+
+// call is the implementation of the wrapper function.
+func (dp *DelayPatcher) call(args []reflect.Value) []reflect.Value {
+	d, original := dp.selectDelay()
+
+	// Wait for the delay, respecting the context
+	ctx := context.Background()
+	if dp.hasCtx {
+		if argCtx, ok := args[0].Interface().(context.Context); ok && argCtx != nil {
+			ctx = argCtx
+		}
+	}
+	if d > 0 {
+		if err := Sleep(ctx, d); err != nil {
+			return zeroResults(dp.variable.Type(), dp.errIdx, err)
+		}
+	}
+
+	if dp.variable.Type().IsVariadic() {
+		return original.CallSlice(args)
+	}
+
+	return original.Call(args)
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (dp *DelayPatcher) Install() Patcher {
+	dp.lock.Lock()
+	defer dp.lock.Unlock()
+
+	// Be idempotent
+	if dp.applied {
+		return dp
+	}
+
+	// Save the original function and reset the counters
+	dp.original = reflect.New(dp.variable.Type()).Elem()
+	dp.original.Set(dp.variable)
+	dp.calls = 0
+	dp.delays = nil
+
+	// Install the wrapper
+	dp.variable.Set(reflect.MakeFunc(dp.variable.Type(), dp.call))
+	dp.applied = true
+
+	return dp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (dp *DelayPatcher) Restore() Patcher {
+	dp.lock.Lock()
+	defer dp.lock.Unlock()
+
+	// Be idempotent
+	if !dp.applied {
+		return dp
+	}
+
+	// Restore the original function
+	dp.variable.Set(dp.original)
+	dp.applied = false
+
+	return dp
+}
+
+// Global implements GlobalPatcher.  A DelayPatcher always touches
+// process-global state, since the delays, and the distribution's view
+// of the call count, are shared by every caller of the function,
+// including any test running in parallel.
+func (dp *DelayPatcher) Global() bool {
+	return true
+}
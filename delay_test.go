@@ -0,0 +1,264 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelayPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*GlobalPatcher)(nil), &DelayPatcher{})
+}
+
+type fakeClock struct {
+	lock   sync.Mutex
+	slept  []time.Duration
+	result error
+}
+
+func (fc *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	fc.slept = append(fc.slept, d)
+	if fc.result != nil {
+		return fc.result
+	}
+
+	return ctx.Err()
+}
+
+func TestSleepContextElapsed(t *testing.T) {
+	err := sleepContext(context.Background(), time.Millisecond)
+
+	assert.NoError(t, err)
+}
+
+func TestSleepContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := sleepContext(ctx, time.Hour)
+
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestFixedDelay(t *testing.T) {
+	dist := FixedDelay(time.Second)
+
+	assert.Equal(t, time.Second, dist(1))
+	assert.Equal(t, time.Second, dist(2))
+}
+
+func TestRandomDelay(t *testing.T) {
+	sample := func(dist DelayDistribution) []time.Duration {
+		result := make([]time.Duration, 100)
+		for i := range result {
+			result[i] = dist(i + 1)
+		}
+		return result
+	}
+
+	first := sample(RandomDelay(time.Second, 2*time.Second, 42))
+
+	assert.Equal(t, first, sample(RandomDelay(time.Second, 2*time.Second, 42)))
+	for _, d := range first {
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.Less(t, d, 2*time.Second)
+	}
+	assert.NotEqual(t, first[0], first[1])
+	assert.Equal(t, time.Second, RandomDelay(time.Second, time.Second, 42)(1))
+}
+
+func TestScriptedDelay(t *testing.T) {
+	dist := ScriptedDelay(time.Second, 0, time.Minute)
+
+	result := []time.Duration{}
+	for call := 1; call <= 5; call++ {
+		result = append(result, dist(call))
+	}
+
+	assert.Equal(t, []time.Duration{time.Second, 0, time.Minute, time.Minute, time.Minute}, result)
+	assert.Equal(t, time.Duration(0), ScriptedDelay()(1))
+}
+
+func TestDelayBase(t *testing.T) {
+	fn := func(context.Context, string) ([]byte, error) { return nil, nil }
+
+	dp := Delay(&fn, FixedDelay(time.Second))
+
+	assert.Equal(t, 1, dp.errIdx)
+	assert.True(t, dp.hasCtx)
+	assert.False(t, dp.applied)
+}
+
+func TestDelayNoContext(t *testing.T) {
+	fn := func(string, context.Context) {}
+
+	dp := Delay(&fn, FixedDelay(time.Second))
+
+	assert.Equal(t, -1, dp.errIdx)
+	assert.False(t, dp.hasCtx)
+}
+
+func TestDelayBadVariable(t *testing.T) {
+	fn := func() {}
+	str := "string"
+
+	for _, variable := range []interface{}{fn, &str} {
+		assert.PanicsWithValue(t, "cannot add delay to variable passed to Delay!", func() {
+			Delay(variable, FixedDelay(time.Second))
+		})
+	}
+}
+
+func TestDelayNilDistribution(t *testing.T) {
+	fn := func() {}
+
+	assert.PanicsWithValue(t, "cannot use nil distribution passed to Delay!", func() {
+		Delay(&fn, nil)
+	})
+}
+
+func TestDelayPatcherCall(t *testing.T) {
+	clock := &fakeClock{}
+	defer SetVar(&Sleep, clock.sleep).Install().Restore()
+	fn := func(ctx context.Context, s string) (string, error) { return strings.ToUpper(s), nil }
+	dp := Delay(&fn, ScriptedDelay(time.Second, 0, time.Minute))
+	defer dp.Install().Restore()
+
+	results := []string{}
+	for _, arg := range []string{"one", "two", "three"} {
+		s, err := fn(context.Background(), arg)
+		assert.NoError(t, err)
+		results = append(results, s)
+	}
+
+	assert.Equal(t, []string{"ONE", "TWO", "THREE"}, results)
+	assert.Equal(t, []time.Duration{time.Second, time.Minute}, clock.slept)
+	assert.Equal(t, []time.Duration{time.Second, 0, time.Minute}, dp.Delays())
+}
+
+func TestDelayPatcherContextDone(t *testing.T) {
+	clock := &fakeClock{}
+	defer SetVar(&Sleep, clock.sleep).Install().Restore()
+	called := false
+	fn := func(ctx context.Context) (int, error) {
+		called = true
+		return 1, nil
+	}
+	defer Delay(&fn, FixedDelay(time.Second)).Install().Restore()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	n, err := fn(ctx)
+
+	assert.Equal(t, 0, n)
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, called)
+}
+
+func TestDelayPatcherNilContext(t *testing.T) {
+	clock := &fakeClock{}
+	defer SetVar(&Sleep, clock.sleep).Install().Restore()
+	fn := func(ctx context.Context) int { return 1 }
+	defer Delay(&fn, FixedDelay(time.Second)).Install().Restore()
+
+	assert.Equal(t, 1, fn(nil)) //nolint:staticcheck
+	assert.Equal(t, []time.Duration{time.Second}, clock.slept)
+}
+
+func TestDelayPatcherSleepFailsNoError(t *testing.T) {
+	clock := &fakeClock{result: assert.AnError}
+	defer SetVar(&Sleep, clock.sleep).Install().Restore()
+	fn := func() int { return 1 }
+	defer Delay(&fn, FixedDelay(time.Second)).Install().Restore()
+
+	assert.Equal(t, 0, fn())
+}
+
+func TestDelayPatcherRealSleep(t *testing.T) {
+	fn := func(ctx context.Context) error { return nil }
+	defer Delay(&fn, FixedDelay(time.Hour)).Install().Restore()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	err := fn(ctx)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDelayPatcherVariadic(t *testing.T) {
+	clock := &fakeClock{}
+	defer SetVar(&Sleep, clock.sleep).Install().Restore()
+	fn := func(sep string, parts ...string) string { return strings.Join(parts, sep) }
+	defer Delay(&fn, FixedDelay(time.Second)).Install().Restore()
+
+	assert.Equal(t, "a-b", fn("-", "a", "b"))
+}
+
+func TestDelayPatcherInstallIdempotent(t *testing.T) {
+	clock := &fakeClock{}
+	defer SetVar(&Sleep, clock.sleep).Install().Restore()
+	fn := func() {}
+	dp := Delay(&fn, FixedDelay(time.Second))
+	dp.Install()
+	defer dp.Restore()
+	fn()
+
+	result := dp.Install()
+
+	assert.Same(t, dp, result)
+	assert.Len(t, dp.Delays(), 1)
+}
+
+func TestDelayPatcherRestore(t *testing.T) {
+	clock := &fakeClock{}
+	defer SetVar(&Sleep, clock.sleep).Install().Restore()
+	fn := func() {}
+	dp := Delay(&fn, FixedDelay(time.Second))
+	dp.Install()
+
+	result := dp.Restore()
+	fn()
+
+	assert.Same(t, dp, result)
+	assert.False(t, dp.applied)
+	assert.Empty(t, clock.slept)
+}
+
+func TestDelayPatcherRestoreIdempotent(t *testing.T) {
+	fn := func() {}
+	dp := Delay(&fn, FixedDelay(time.Second))
+
+	result := dp.Restore()
+
+	assert.Same(t, dp, result)
+	assert.False(t, dp.applied)
+}
+
+func TestDelayPatcherConcurrent(t *testing.T) {
+	fn := func() {}
+
+	hammer(Delay(&fn, FixedDelay(time.Second)))
+
+	assert.NotPanics(t, fn)
+}
@@ -14,13 +14,21 @@
 
 package patcher
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
 
 // EnvPatcher is a patcher that, given an environment variable name,
 // will set or unset that environment variable.
 type EnvPatcher struct {
+	lock     sync.Mutex
 	name     string
 	value    *string
+	provider func() string
+	reporter TamperReporter
 	original *string
 	applied  bool
 }
@@ -73,6 +81,38 @@ func SetEnv(name, value string) *EnvPatcher {
 	}
 }
 
+// SetEnvFunc constructs an EnvPatcher, storing a provider function
+// that computes the desired value of the specified environment
+// variable.  The provider is called each time the patch is installed,
+// so it may use resources that only exist once earlier patches in a
+// PatchMaster have been installed.  The computed value is available
+// from the Value method.  It could be used in a test function like
+// so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		server := HTTPServer(handler)
+//		defer NewPatchMaster(
+//			server,
+//			SetEnvFunc("SERVICE_URL", server.URL),
+//		).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func SetEnvFunc(name string, provider func() string) *EnvPatcher {
+	if provider == nil {
+		panic("cannot use nil provider passed to SetEnvFunc!")
+	}
+
+	return &EnvPatcher{
+		name:     name,
+		provider: provider,
+	}
+}
+
 // UnsetEnv constructs an EnvPatcher.  The specified environment
 // variable will be unset when the patch is installed.  It could be
 // used in a test function like so:
@@ -92,10 +132,64 @@ func UnsetEnv(name string) *EnvPatcher {
 	}
 }
 
+// Value returns the value the environment variable is set to while
+// the patch is installed, and a boolean that is false if the
+// environment variable is unset instead.  For an EnvPatcher
+// constructed with SetEnvFunc, this is the value computed by the most
+// recent Install; the boolean is false if the patch has never been
+// installed.
+func (ep *EnvPatcher) Value() (string, bool) {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	if ep.value == nil {
+		return "", false
+	}
+
+	return *ep.value, true
+}
+
+// envString formats the value of an environment variable for a
+// TamperReporter.
+func envString(value *string) string {
+	if value == nil {
+		return "(unset)"
+	}
+
+	return strconv.Quote(*value)
+}
+
+// DetectTampering sets a TamperReporter that is called if, when the
+// patch is restored, the environment variable no longer has the value
+// set by the patch, or is set when the patch unset it.  Passing nil
+// disables the check.  It returns the EnvPatcher, so it could be used
+// in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer SetEnv("VARNAME", "value").DetectTampering(TamperTB(t)).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func (ep *EnvPatcher) DetectTampering(reporter TamperReporter) *EnvPatcher {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	ep.reporter = reporter
+
+	return ep
+}
+
 // Install installs the patch.  It should store metadata sufficient to
 // allow Restore to restore the original data.  This method must be
 // idempotent.
 func (ep *EnvPatcher) Install() Patcher {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
 	// Be idempotent
 	if ep.applied {
 		return ep
@@ -108,6 +202,12 @@ func (ep *EnvPatcher) Install() Patcher {
 		ep.original = nil
 	}
 
+	// Compute the value if there's a provider
+	if ep.provider != nil {
+		value := ep.provider()
+		ep.value = &value
+	}
+
 	// Set the environment variable to the desired value
 	setEnv(ep.name, ep.value)
 	ep.applied = true
@@ -118,14 +218,41 @@ func (ep *EnvPatcher) Install() Patcher {
 // Restore uses the metadata stored by Install to restore the patch to
 // its original value.  This method must be idempotent.
 func (ep *EnvPatcher) Restore() Patcher {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
 	// Be idempotent
 	if !ep.applied {
 		return ep
 	}
 
+	// Check whether the environment variable was changed
+	msg := ""
+	if ep.reporter != nil {
+		var current *string
+		if value, ok := lookupenv(ep.name); ok {
+			current = &value
+		}
+		if envString(current) != envString(ep.value) {
+			msg = tamperDiff(fmt.Sprintf("environment variable %s", ep.name), envString(ep.value), envString(current))
+		}
+	}
+
 	// Restore the environment variable to the original value
 	setEnv(ep.name, ep.original)
 	ep.applied = false
 
+	// Report any change
+	if msg != "" {
+		ep.reporter(msg)
+	}
+
 	return ep
 }
+
+// Global implements GlobalPatcher.  The environment is shared by the
+// whole process, so an EnvPatcher always touches process-global
+// state.
+func (ep *EnvPatcher) Global() bool {
+	return true
+}
@@ -15,6 +15,8 @@
 package patcher
 
 import (
+	"fmt"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -192,6 +194,69 @@ func TestUnsetEnv(t *testing.T) {
 	assert.False(t, result.applied)
 }
 
+func TestSetEnvFunc(t *testing.T) {
+	result := SetEnvFunc("ENV", func() string { return "value" })
+
+	assert.Equal(t, "ENV", result.name)
+	assert.Nil(t, result.value)
+	assert.NotNil(t, result.provider)
+	assert.Nil(t, result.original)
+	assert.False(t, result.applied)
+}
+
+func TestSetEnvFuncNilProvider(t *testing.T) {
+	assert.PanicsWithValue(t, "cannot use nil provider passed to SetEnvFunc!", func() {
+		SetEnvFunc("ENV", nil)
+	})
+}
+
+func TestEnvPatcherValueSet(t *testing.T) {
+	value, ok := SetEnv("ENV", "value").Value()
+
+	assert.Equal(t, "value", value)
+	assert.True(t, ok)
+}
+
+func TestEnvPatcherValueUnset(t *testing.T) {
+	value, ok := UnsetEnv("ENV").Value()
+
+	assert.Equal(t, "", value)
+	assert.False(t, ok)
+}
+
+func TestEnvPatcherInstallProvider(t *testing.T) {
+	var set []string
+	defer NewPatchMaster(
+		SetVar(&setenv, func(n, v string) error {
+			assert.Equal(t, "ENV", n)
+			set = append(set, v)
+			return nil
+		}),
+		SetVar(&lookupenv, func(n string) (string, bool) {
+			return "original", true
+		}),
+	).Install().Restore()
+	calls := 0
+	obj := SetEnvFunc("ENV", func() string {
+		calls++
+		return fmt.Sprintf("value-%d", calls)
+	})
+
+	obj.Install()
+	value, ok := obj.Value()
+
+	assert.Equal(t, "value-1", value)
+	assert.True(t, ok)
+
+	obj.Restore()
+	obj.Install()
+	value, ok = obj.Value()
+
+	assert.Equal(t, "value-2", value)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"value-1", "original", "value-2"}, set)
+}
+
 func TestEnvPatcherInstallExists(t *testing.T) {
 	setenvCalled := false
 	lookupenvCalled := false
@@ -382,3 +447,65 @@ func TestEnvPatcherRestoreIdempotent(t *testing.T) {
 	assert.False(t, lookupenvCalled)
 	assert.False(t, unsetenvCalled)
 }
+
+func TestEnvPatcherConcurrent(t *testing.T) {
+	defer SetEnv("PATCHER_TEST_CONCURRENT", "unpatched").Install().Restore()
+
+	hammer(SetEnv("PATCHER_TEST_CONCURRENT", "patched"))
+
+	assert.Equal(t, "unpatched", os.Getenv("PATCHER_TEST_CONCURRENT"))
+}
+
+func TestEnvPatcherDetectTampering(t *testing.T) {
+	ep := SetEnv("ENV", "value")
+
+	result := ep.DetectTampering(TamperPanic)
+
+	assert.Same(t, ep, result)
+	assert.NotNil(t, ep.reporter)
+}
+
+func TestEnvString(t *testing.T) {
+	value := "a\"b"
+
+	assert.Equal(t, "(unset)", envString(nil))
+	assert.Equal(t, `"a\"b"`, envString(&value))
+}
+
+func TestEnvPatcherTamperUnchanged(t *testing.T) {
+	defer UnsetEnv("PATCHER_TEST_TAMPER").Install().Restore()
+	tr := &tamperRecorder{}
+	ep := SetEnv("PATCHER_TEST_TAMPER", "patched").DetectTampering(tr.report)
+
+	ep.Install()
+	ep.Restore()
+
+	assert.Nil(t, tr.messages)
+}
+
+func TestEnvPatcherTamperChanged(t *testing.T) {
+	defer UnsetEnv("PATCHER_TEST_TAMPER").Install().Restore()
+	tr := &tamperRecorder{}
+	ep := SetEnv("PATCHER_TEST_TAMPER", "patched").DetectTampering(tr.report)
+
+	ep.Install()
+	os.Setenv("PATCHER_TEST_TAMPER", "tampered")
+	ep.Restore()
+
+	_, ok := os.LookupEnv("PATCHER_TEST_TAMPER")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"environment variable PATCHER_TEST_TAMPER was changed while patched:\n--- patched\n+++ current\n@@ -1 +1 @@\n-\"patched\"\n+\"tampered\"\n"}, tr.messages)
+}
+
+func TestEnvPatcherTamperSetWhenUnset(t *testing.T) {
+	defer SetEnv("PATCHER_TEST_TAMPER", "original").Install().Restore()
+	tr := &tamperRecorder{}
+	ep := UnsetEnv("PATCHER_TEST_TAMPER").DetectTampering(tr.report)
+
+	ep.Install()
+	os.Setenv("PATCHER_TEST_TAMPER", "tampered")
+	ep.Restore()
+
+	assert.Equal(t, "original", os.Getenv("PATCHER_TEST_TAMPER"))
+	assert.Equal(t, []string{"environment variable PATCHER_TEST_TAMPER was changed while patched:\n--- patched\n+++ current\n@@ -1 +1 @@\n-(unset)\n+\"tampered\"\n"}, tr.messages)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import "errors"
+
+// ErrNoExit is returned by ExpectExit if the function returns without
+// calling the exit function.
+var ErrNoExit = errors.New("function returned without exiting")
+
+// exitSentinel is the value used to panic out of the function passed
+// to ExpectExit when it calls the exit function.
+type exitSentinel struct {
+	code int
+}
+
+// ExpectExit calls a function with an exit function variable, such
+// as one initialized to os.Exit, patched to stop the function at the
+// point of exit.  It returns the exit code passed to the exit
+// function, or ErrNoExit if the function returned without calling
+// it.  The variable is restored before ExpectExit returns, even if
+// the function panics for some other reason; such panics are passed
+// on to the caller.  The exit function must be called from the same
+// goroutine that called ExpectExit, and the function must not recover
+// the panic that the patched exit function uses to unwind it.  It
+// could be used in a test function like so:
+//
+//	var osExit = os.Exit
+//
+//	func TestMain(t *testing.T) {
+//		code, err := ExpectExit(&osExit, main)
+//
+//		if err != nil || code != 2 {
+//			t.Fail("failed to exit with code 2!")
+//		}
+//	}
+func ExpectExit(exitVar *func(int), fn func()) (code int, err error) {
+	defer SetVar(exitVar, func(code int) {
+		panic(&exitSentinel{code: code})
+	}).Install().Restore()
+
+	// Intercept the sentinel panic
+	defer func() {
+		if r := recover(); r != nil {
+			sentinel, ok := r.(*exitSentinel)
+			if !ok {
+				panic(r)
+			}
+
+			code = sentinel.code
+			err = nil
+		}
+	}()
+
+	fn()
+
+	return 0, ErrNoExit
+}
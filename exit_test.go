@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectExitExits(t *testing.T) {
+	exitCalled := false
+	exit := func(code int) {
+		exitCalled = true
+	}
+	reached := false
+
+	code, err := ExpectExit(&exit, func() {
+		exit(3)
+		reached = true
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, code)
+	assert.False(t, reached)
+	exit(0)
+	assert.True(t, exitCalled)
+}
+
+func TestExpectExitReturns(t *testing.T) {
+	exitCalled := false
+	exit := func(code int) {
+		exitCalled = true
+	}
+
+	code, err := ExpectExit(&exit, func() {})
+
+	assert.ErrorIs(t, err, ErrNoExit)
+	assert.Equal(t, 0, code)
+	exit(0)
+	assert.True(t, exitCalled)
+}
+
+func TestExpectExitPanics(t *testing.T) {
+	exitCalled := false
+	exit := func(code int) {
+		exitCalled = true
+	}
+
+	assert.PanicsWithValue(t, "unrelated", func() {
+		_, _ = ExpectExit(&exit, func() {
+			panic("unrelated")
+		})
+	})
+	exit(0)
+	assert.True(t, exitCalled)
+}
@@ -0,0 +1,362 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+)
+
+// ErrInjected is the error injected by InjectError when no error is
+// specified.
+var ErrInjected = errors.New("injected fault")
+
+// contextType is the reflected type of context.Context.
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// errorIndex returns the index of the last error return value of a
+// function type, or -1 if it has none.
+func errorIndex(typ reflect.Type) int {
+	for i := typ.NumOut() - 1; i >= 0; i-- {
+		if typ.Out(i) == errorType {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// zeroResults returns zero values for the results of a function type,
+// with the error result at errIdx, if any, set to err.
+func zeroResults(typ reflect.Type, errIdx int, err error) []reflect.Value {
+	results := make([]reflect.Value, typ.NumOut())
+	for i := range results {
+		results[i] = reflect.New(typ.Out(i)).Elem()
+	}
+	if errIdx >= 0 && err != nil {
+		results[errIdx].Set(reflect.ValueOf(err))
+	}
+
+	return results
+}
+
+// FaultTrigger is a function that selects the calls into which a
+// fault is injected.  It is passed the call number, starting at 1,
+// and the arguments of the call.
+type FaultTrigger func(call int, args []interface{}) bool
+
+// NthCall is a FaultTrigger that selects the nth call.
+func NthCall(n int) FaultTrigger {
+	return func(call int, _ []interface{}) bool {
+		return call == n
+	}
+}
+
+// EveryKthCall is a FaultTrigger that selects every kth call: the
+// kth, 2kth, and so on.
+func EveryKthCall(k int) FaultTrigger {
+	return func(call int, _ []interface{}) bool {
+		return k > 0 && call%k == 0
+	}
+}
+
+// Probability is a FaultTrigger that selects calls with the specified
+// probability.  The random number generator is seeded with the
+// specified seed, so the selected calls are reproducible.
+func Probability(p float64, seed int64) FaultTrigger {
+	lock := &sync.Mutex{}
+	rng := rand.New(rand.NewSource(seed)) //nolint:gosec // reproducible, not secure
+
+	return func(int, []interface{}) bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return rng.Float64() < p
+	}
+}
+
+// ArgsMatch is a FaultTrigger that selects calls whose arguments
+// satisfy a predicate.
+func ArgsMatch(pred func(args []interface{}) bool) FaultTrigger {
+	return func(_ int, args []interface{}) bool {
+		return pred(args)
+	}
+}
+
+// faultKind is the kind of a fault.
+type faultKind int
+
+// Kinds of faults.
+const (
+	faultError faultKind = iota
+	faultPanic
+	faultHang
+)
+
+// Fault describes a fault to inject into a call.  The zero value
+// injects ErrInjected.
+type Fault struct {
+	kind  faultKind
+	err   error
+	value interface{}
+}
+
+// InjectError is a Fault that makes the call return an error, without
+// calling the original function.  The other return values are zero
+// values.  If err is nil, ErrInjected is returned.  The function must
+// have an error return value.
+func InjectError(err error) Fault {
+	if err == nil {
+		err = ErrInjected
+	}
+
+	return Fault{
+		kind: faultError,
+		err:  err,
+	}
+}
+
+// InjectPanic is a Fault that makes the call panic with the specified
+// value, without calling the original function.
+func InjectPanic(value interface{}) Fault {
+	return Fault{
+		kind:  faultPanic,
+		value: value,
+	}
+}
+
+// InjectHang is a Fault that makes the call block until its context
+// argument is done, without calling the original function.  The call
+// then returns the context's error, if the function has an error
+// return value; the other return values are zero values.  The
+// function must have a context.Context parameter.
+func InjectHang() Fault {
+	return Fault{
+		kind: faultHang,
+	}
+}
+
+// FaultPolicy describes a fault to inject and the calls to inject it
+// into.
+type FaultPolicy struct {
+	Trigger FaultTrigger // Selects the calls
+	Fault   Fault        // The fault to inject
+}
+
+// Injection describes a fault that was injected.
+type Injection struct {
+	Call   int           // The call number, starting at 1
+	Policy int           // The index of the policy that fired
+	Args   []interface{} // The arguments of the call
+}
+
+// FaultPatcher is a patcher that, given a pointer to a function
+// variable, wraps the function to inject faults into selected calls.
+type FaultPatcher struct {
+	lock       sync.Mutex
+	variable   reflect.Value
+	policies   []FaultPolicy
+	errIdx     int
+	ctxIdx     int
+	original   reflect.Value
+	calls      int
+	injections []Injection
+	applied    bool
+}
+
+// Faults constructs a FaultPatcher, storing the function variable and
+// the fault policies.  While installed, each call to the function is
+// checked against the policies in order; the fault of the first
+// policy whose trigger selects the call is injected, and calls not
+// selected by any policy are passed to the original function.  The
+// call count starts over each time the patch is installed.  It will
+// panic if the variable is not a function variable, or if a fault
+// cannot be injected into the function.  It could be used in a test
+// function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		fp := Faults(&readFile, FaultPolicy{
+//			Trigger: NthCall(2),
+//			Fault:   InjectError(os.ErrPermission),
+//		})
+//		defer fp.Install().Restore()
+//
+//		err := DoSomething("some-filename")
+//
+//		if !errors.Is(err, os.ErrPermission) || len(fp.Injections()) != 1 {
+//			t.Fail("fault not injected!")
+//		}
+//	}
+func Faults(variable interface{}, policies ...FaultPolicy) *FaultPatcher {
+	// Select the variable and validate it's a function variable
+	varReflect := reflect.ValueOf(variable)
+	if varReflect.Kind() != reflect.Ptr || varReflect.Elem().Kind() != reflect.Func {
+		panic("cannot inject faults into variable passed to Faults!")
+	}
+	v := varReflect.Elem()
+
+	fp := &FaultPatcher{
+		variable: v,
+		policies: policies,
+		ctxIdx:   -1,
+	}
+
+	// Find the error return value and the context parameter
+	typ := v.Type()
+	fp.errIdx = errorIndex(typ)
+	for i := 0; i < typ.NumIn(); i++ {
+		if typ.In(i).Implements(contextType) {
+			fp.ctxIdx = i
+			break
+		}
+	}
+
+	// Validate the faults
+	for i, policy := range policies {
+		switch {
+		case policy.Trigger == nil:
+			panic(fmt.Sprintf("fault policy %d has no trigger", i))
+		case policy.Fault.kind == faultError && fp.errIdx < 0:
+			panic(fmt.Sprintf("cannot inject error into function type %s", typ))
+		case policy.Fault.kind == faultHang && fp.ctxIdx < 0:
+			panic(fmt.Sprintf("cannot inject hang into function type %s", typ))
+		}
+	}
+
+	return fp
+}
+
+// Injections returns a list of the faults injected since the patch
+// was last installed.
+func (fp *FaultPatcher) Injections() []Injection {
+	fp.lock.Lock()
+	defer fp.lock.Unlock()
+
+	return append([]Injection(nil), fp.injections...)
+}
+
+// selectFault counts a call and selects the fault to inject into it,
+// if any.
+func (fp *FaultPatcher) selectFault(args []reflect.Value) (*Fault, reflect.Value) {
+	fp.lock.Lock()
+	defer fp.lock.Unlock()
+
+	fp.calls++
+	argIfaces := make([]interface{}, len(args))
+	for i, arg := range args {
+		argIfaces[i] = arg.Interface()
+	}
+
+	for i := range fp.policies {
+		if fp.policies[i].Trigger(fp.calls, argIfaces) {
+			fp.injections = append(fp.injections, Injection{
+				Call:   fp.calls,
+				Policy: i,
+				Args:   argIfaces,
+			})
+
+			return &fp.policies[i].Fault, fp.original
+		}
+	}
+
+	return nil, fp.original
+}
+
+// call is the implementation of the wrapper function.
+func (fp *FaultPatcher) call(args []reflect.Value) []reflect.Value {
+	fault, original := fp.selectFault(args)
+	if fault == nil {
+		if fp.variable.Type().IsVariadic() {
+			return original.CallSlice(args)
+		}
+		return original.Call(args)
+	}
+
+	switch fault.kind {
+	case faultError:
+		if fault.err == nil {
+			return zeroResults(fp.variable.Type(), fp.errIdx, ErrInjected)
+		}
+		return zeroResults(fp.variable.Type(), fp.errIdx, fault.err)
+
+	case faultPanic:
+		panic(fault.value)
+
+	case faultHang:
+		ctx, ok := args[fp.ctxIdx].Interface().(context.Context)
+		if !ok || ctx == nil {
+			panic("cannot inject hang: nil context")
+		}
+		<-ctx.Done()
+		return zeroResults(fp.variable.Type(), fp.errIdx, ctx.Err())
+	}
+
+	panic(fmt.Sprintf("unknown fault kind %d", fault.kind))
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (fp *FaultPatcher) Install() Patcher {
+	fp.lock.Lock()
+	defer fp.lock.Unlock()
+
+	// Be idempotent
+	if fp.applied {
+		return fp
+	}
+
+	// Save the original function and reset the counters
+	fp.original = reflect.New(fp.variable.Type()).Elem()
+	fp.original.Set(fp.variable)
+	fp.calls = 0
+	fp.injections = nil
+
+	// Install the wrapper
+	fp.variable.Set(reflect.MakeFunc(fp.variable.Type(), fp.call))
+	fp.applied = true
+
+	return fp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (fp *FaultPatcher) Restore() Patcher {
+	fp.lock.Lock()
+	defer fp.lock.Unlock()
+
+	// Be idempotent
+	if !fp.applied {
+		return fp
+	}
+
+	// Restore the original function
+	fp.variable.Set(fp.original)
+	fp.applied = false
+
+	return fp
+}
+
+// Global implements GlobalPatcher.  A FaultPatcher always touches
+// process-global state: the fault policy's call counts are shared by
+// every caller of the function, so calls made by tests running in
+// parallel would trigger, or use up, the injected faults.
+func (fp *FaultPatcher) Global() bool {
+	return true
+}
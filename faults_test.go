@@ -0,0 +1,278 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*GlobalPatcher)(nil), &FaultPatcher{})
+}
+
+func TestNthCall(t *testing.T) {
+	trigger := NthCall(2)
+
+	assert.False(t, trigger(1, nil))
+	assert.True(t, trigger(2, nil))
+	assert.False(t, trigger(3, nil))
+}
+
+func TestEveryKthCall(t *testing.T) {
+	trigger := EveryKthCall(3)
+
+	result := []bool{}
+	for call := 1; call <= 6; call++ {
+		result = append(result, trigger(call, nil))
+	}
+
+	assert.Equal(t, []bool{false, false, true, false, false, true}, result)
+	assert.False(t, EveryKthCall(0)(1, nil))
+}
+
+func TestProbability(t *testing.T) {
+	sample := func(trigger FaultTrigger) []bool {
+		result := make([]bool, 100)
+		for i := range result {
+			result[i] = trigger(i+1, nil)
+		}
+		return result
+	}
+
+	first := sample(Probability(0.5, 42))
+
+	assert.Equal(t, first, sample(Probability(0.5, 42)))
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+	assert.NotContains(t, sample(Probability(0, 42)), true)
+	assert.NotContains(t, sample(Probability(1, 42)), false)
+}
+
+func TestArgsMatch(t *testing.T) {
+	trigger := ArgsMatch(func(args []interface{}) bool {
+		return args[0] == "match"
+	})
+
+	assert.True(t, trigger(1, []interface{}{"match"}))
+	assert.False(t, trigger(1, []interface{}{"other"}))
+}
+
+func TestInjectError(t *testing.T) {
+	assert.Equal(t, Fault{kind: faultError, err: assert.AnError}, InjectError(assert.AnError))
+	assert.Equal(t, Fault{kind: faultError, err: ErrInjected}, InjectError(nil))
+}
+
+func TestFaultsBase(t *testing.T) {
+	fn := func(string) ([]byte, error) { return nil, nil }
+	policy := FaultPolicy{Trigger: NthCall(1), Fault: InjectError(nil)}
+
+	fp := Faults(&fn, policy)
+
+	assert.Len(t, fp.policies, 1)
+	assert.Equal(t, policy.Fault, fp.policies[0].Fault)
+	assert.Equal(t, 1, fp.errIdx)
+	assert.Equal(t, -1, fp.ctxIdx)
+	assert.False(t, fp.applied)
+}
+
+func TestFaultsContextParameter(t *testing.T) {
+	fn := func(int, context.Context) {}
+
+	fp := Faults(&fn, FaultPolicy{Trigger: NthCall(1), Fault: InjectHang()})
+
+	assert.Equal(t, -1, fp.errIdx)
+	assert.Equal(t, 1, fp.ctxIdx)
+}
+
+func TestFaultsBadVariable(t *testing.T) {
+	fn := func() {}
+	str := "string"
+
+	for _, variable := range []interface{}{fn, &str} {
+		assert.PanicsWithValue(t, "cannot inject faults into variable passed to Faults!", func() {
+			Faults(variable)
+		})
+	}
+}
+
+func TestFaultsBadPolicy(t *testing.T) {
+	fn := func() int { return 0 }
+
+	assert.PanicsWithValue(t, "fault policy 0 has no trigger", func() {
+		Faults(&fn, FaultPolicy{})
+	})
+	assert.PanicsWithValue(t, "cannot inject error into function type func() int", func() {
+		Faults(&fn, FaultPolicy{Trigger: NthCall(1), Fault: InjectError(nil)})
+	})
+	assert.PanicsWithValue(t, "cannot inject hang into function type func() int", func() {
+		Faults(&fn, FaultPolicy{Trigger: NthCall(1), Fault: InjectHang()})
+	})
+}
+
+func TestFaultPatcherInjectError(t *testing.T) {
+	fn := func(s string) (string, int, error) { return strings.ToUpper(s), len(s), nil }
+	fp := Faults(&fn,
+		FaultPolicy{Trigger: NthCall(2), Fault: InjectError(assert.AnError)},
+		FaultPolicy{Trigger: EveryKthCall(2), Fault: Fault{}},
+	)
+	defer fp.Install().Restore()
+
+	results := [][]interface{}{}
+	for _, arg := range []string{"one", "two", "three", "four"} {
+		s, n, err := fn(arg)
+		results = append(results, []interface{}{s, n, err})
+	}
+
+	assert.Equal(t, [][]interface{}{
+		{"ONE", 3, nil},
+		{"", 0, assert.AnError},
+		{"THREE", 5, nil},
+		{"", 0, ErrInjected},
+	}, results)
+	assert.Equal(t, []Injection{
+		{Call: 2, Policy: 0, Args: []interface{}{"two"}},
+		{Call: 4, Policy: 1, Args: []interface{}{"four"}},
+	}, fp.Injections())
+}
+
+func TestFaultPatcherInjectPanic(t *testing.T) {
+	fn := func() {}
+	fp := Faults(&fn, FaultPolicy{Trigger: NthCall(1), Fault: InjectPanic("injected")})
+	defer fp.Install().Restore()
+
+	assert.PanicsWithValue(t, "injected", fn)
+	assert.NotPanics(t, fn)
+	assert.Len(t, fp.Injections(), 1)
+}
+
+func TestFaultPatcherInjectHang(t *testing.T) {
+	fn := func(ctx context.Context) (int, error) { return 1, nil }
+	fp := Faults(&fn, FaultPolicy{
+		Trigger: ArgsMatch(func(args []interface{}) bool {
+			return args[0] != context.Background()
+		}),
+		Fault: InjectHang(),
+	})
+	defer fp.Install().Restore()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+
+	go func() {
+		_, err := fn(ctx)
+		result <- err
+	}()
+	select {
+	case <-result:
+		t.Fatal("call did not hang")
+	default:
+	}
+	cancel()
+
+	assert.Equal(t, context.Canceled, <-result)
+	n, err := fn(context.Background())
+	assert.Equal(t, 1, n)
+	assert.NoError(t, err)
+}
+
+func TestFaultPatcherInjectHangNilContext(t *testing.T) {
+	fn := func(ctx context.Context) {}
+	fp := Faults(&fn, FaultPolicy{Trigger: NthCall(1), Fault: InjectHang()})
+	defer fp.Install().Restore()
+
+	assert.PanicsWithValue(t, "cannot inject hang: nil context", func() {
+		fn(nil) //nolint:staticcheck
+	})
+}
+
+func TestFaultPatcherUnknownKind(t *testing.T) {
+	fn := func() {}
+	fp := Faults(&fn, FaultPolicy{Trigger: NthCall(1), Fault: Fault{kind: faultKind(99)}})
+	defer fp.Install().Restore()
+
+	assert.PanicsWithValue(t, "unknown fault kind 99", fn)
+}
+
+func TestFaultPatcherVariadic(t *testing.T) {
+	fn := func(sep string, parts ...string) string { return strings.Join(parts, sep) }
+	fp := Faults(&fn, FaultPolicy{Trigger: NthCall(2), Fault: InjectPanic("injected")})
+	defer fp.Install().Restore()
+
+	assert.Equal(t, "a-b", fn("-", "a", "b"))
+	assert.Panics(t, func() { fn("-") })
+	assert.Equal(t, []Injection{{Call: 2, Policy: 0, Args: []interface{}{"-", []string(nil)}}}, fp.Injections())
+}
+
+func TestFaultPatcherReinstall(t *testing.T) {
+	fn := func() error { return nil }
+	fp := Faults(&fn, FaultPolicy{Trigger: NthCall(1), Fault: InjectError(nil)})
+	fp.Install()
+	assert.Error(t, fn())
+	fp.Restore()
+
+	fp.Install()
+	defer fp.Restore()
+
+	assert.Error(t, fn())
+	assert.Len(t, fp.Injections(), 1)
+}
+
+func TestFaultPatcherInstallIdempotent(t *testing.T) {
+	fn := func() error { return nil }
+	fp := Faults(&fn, FaultPolicy{Trigger: NthCall(1), Fault: InjectError(nil)})
+	fp.Install()
+	defer fp.Restore()
+	assert.Error(t, fn())
+
+	result := fp.Install()
+
+	assert.Same(t, fp, result)
+	assert.NoError(t, fn())
+}
+
+func TestFaultPatcherRestore(t *testing.T) {
+	fn := func() error { return nil }
+	fp := Faults(&fn, FaultPolicy{Trigger: EveryKthCall(1), Fault: InjectError(nil)})
+	fp.Install()
+	assert.Error(t, fn())
+
+	result := fp.Restore()
+
+	assert.Same(t, fp, result)
+	assert.False(t, fp.applied)
+	assert.NoError(t, fn())
+	assert.Len(t, fp.Injections(), 1)
+}
+
+func TestFaultPatcherRestoreIdempotent(t *testing.T) {
+	fn := func() error { return nil }
+	fp := Faults(&fn)
+
+	result := fp.Restore()
+
+	assert.Same(t, fp, result)
+	assert.NoError(t, fn())
+}
+
+func TestFaultPatcherConcurrent(t *testing.T) {
+	fn := func() error { return nil }
+
+	hammer(Faults(&fn, FaultPolicy{Trigger: EveryKthCall(1), Fault: InjectError(nil)}))
+
+	assert.NoError(t, fn())
+}
@@ -0,0 +1,405 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Kinds of steps in a field path.
+const (
+	stepField = iota // A struct field, possibly promoted
+	stepIndex        // An index into a slice or array
+	stepKey          // A key into a map
+)
+
+// fieldStep describes a single step in a field path.
+type fieldStep struct {
+	kind  int           // The kind of step
+	desc  string        // The path up to and including this step
+	field []int         // The field index sequence for stepField
+	index int           // The index for stepIndex
+	key   reflect.Value // The key for stepKey
+}
+
+// FieldOption is an option that may be passed to SetField.
+type FieldOption func(fs *FieldSetter)
+
+// AllowUnexported is a FieldOption that allows the field path to
+// include unexported struct fields.  Unexported fields are set using
+// the unsafe package, bypassing the protections normally enforced by
+// reflection.
+func AllowUnexported() FieldOption {
+	return func(fs *FieldSetter) {
+		fs.unexported = true
+	}
+}
+
+// FieldSetter is a patcher that, given a pointer to a variable, a
+// path to a field within that variable, and the desired patch value,
+// will set only that field to that value.
+type FieldSetter struct {
+	lock       sync.Mutex
+	variable   reflect.Value
+	path       string
+	steps      []fieldStep
+	value      reflect.Value
+	unexported bool
+	target     reflect.Value
+	original   reflect.Value
+	present    bool
+	applied    bool
+}
+
+// SetField constructs a FieldSetter, storing the variable, the path
+// to the field to set, and its desired new value.  The path is a
+// sequence of struct field names separated by ".", slice or array
+// indices such as "[0]", and map keys such as "[key]"; pointers along
+// the path are followed automatically.  Map keys are interpreted
+// according to the key type of the map; string keys may be quoted
+// with Go syntax if they contain "]".  Values found in a map may only
+// be descended into if they are pointers, maps, or slices, since
+// other map values cannot be modified in place.  If the last step of
+// the path is a map key, the entry is added if necessary and deleted
+// again on restore.  SetField will panic if the path does not match
+// the type of the variable, if it names an unexported field without
+// the AllowUnexported option, or if the value cannot be assigned to
+// the field.  It could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer SetField(&Config, "Server.TLS.Port", 8443).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func SetField(variable interface{}, path string, value interface{}, opts ...FieldOption) *FieldSetter {
+	// Select the variable and validate it's a settable object
+	varReflect := reflect.ValueOf(variable)
+	if varReflect.Kind() != reflect.Ptr || varReflect.IsNil() {
+		panic("cannot set variable passed to SetField!")
+	}
+
+	fs := &FieldSetter{
+		variable: varReflect.Elem(),
+		path:     path,
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	// Parse the path and check that the value can be assigned to
+	// the field
+	typ := fs.parse()
+	fs.value = reflect.ValueOf(value)
+	if !fs.value.IsValid() || !fs.value.Type().AssignableTo(typ) {
+		panic(fmt.Sprintf("cannot assign %T type to field %s type %s", value, path, typ))
+	}
+
+	return fs
+}
+
+// splitPath splits a field path into its components.  Struct field
+// names are returned as is, and indices and keys are returned with
+// their enclosing brackets.
+func splitPath(path string) ([]string, bool) {
+	var parts []string
+	for i := 0; i < len(path); {
+		switch {
+		case path[i] == '[':
+			end := i + 1
+			if end < len(path) && path[end] == '"' {
+				// Find the end of the quoted key
+				quoted, err := strconv.QuotedPrefix(path[end:])
+				if err != nil {
+					return nil, false
+				}
+				end += len(quoted)
+			} else {
+				end += strings.IndexByte(path[end:], ']')
+			}
+			if end <= i || end >= len(path) || path[end] != ']' {
+				return nil, false
+			}
+			parts = append(parts, path[i:end+1])
+			i = end + 1
+
+		case path[i] == '.' && i > 0:
+			i++
+			fallthrough
+
+		default:
+			// Field names must follow a "."
+			if i > 0 && path[i-1] != '.' {
+				return nil, false
+			}
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			if end == 0 {
+				return nil, false
+			}
+			parts = append(parts, path[i:i+end])
+			i += end
+		}
+	}
+
+	return parts, len(parts) > 0
+}
+
+// parseKey converts a map key from a field path into a value of the
+// map's key type.
+func parseKey(text string, typ reflect.Type) (reflect.Value, error) {
+	key := reflect.New(typ).Elem()
+
+	var err error
+	switch typ.Kind() {
+	case reflect.String:
+		if strings.HasPrefix(text, `"`) {
+			text, err = strconv.Unquote(text)
+		}
+		key.SetString(text)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(text, 0, typ.Bits())
+		key.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		u, err = strconv.ParseUint(text, 0, typ.Bits())
+		key.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(text, typ.Bits())
+		key.SetFloat(f)
+
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(text)
+		key.SetBool(b)
+
+	case reflect.Invalid, reflect.Complex64, reflect.Complex128, reflect.Array, reflect.Chan, reflect.Func,
+		reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice, reflect.Struct, reflect.UnsafePointer:
+		err = strconv.ErrSyntax
+	}
+
+	return key, err
+}
+
+// parse parses the field path into steps, validating it against the
+// type of the variable.  It returns the type of the field.
+func (fs *FieldSetter) parse() reflect.Type {
+	parts, ok := splitPath(fs.path)
+	if !ok {
+		panic(fmt.Sprintf("invalid field path %q", fs.path))
+	}
+
+	typ := fs.variable.Type()
+	desc := ""
+	for i, part := range parts {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+
+		// Handle struct fields
+		if part[0] != '[' {
+			desc = strings.TrimPrefix(desc+"."+part, ".")
+			if typ.Kind() != reflect.Struct {
+				panic(fmt.Sprintf("cannot select field %s of type %s", desc, typ))
+			}
+			sf, ok := typ.FieldByName(part)
+			if !ok {
+				panic(fmt.Sprintf("no field %s in type %s", desc, typ))
+			}
+			if !sf.IsExported() && !fs.unexported {
+				panic(fmt.Sprintf("cannot set unexported field %s", desc))
+			}
+			fs.steps = append(fs.steps, fieldStep{kind: stepField, desc: desc, field: sf.Index})
+			typ = sf.Type
+			continue
+		}
+
+		// Handle indices and keys
+		desc += part
+		text := part[1 : len(part)-1]
+		switch typ.Kind() {
+		case reflect.Slice, reflect.Array:
+			idx, err := strconv.Atoi(text)
+			if err != nil || idx < 0 || (typ.Kind() == reflect.Array && idx >= typ.Len()) {
+				panic(fmt.Sprintf("invalid index %s for type %s", desc, typ))
+			}
+			fs.steps = append(fs.steps, fieldStep{kind: stepIndex, desc: desc, index: idx})
+
+		case reflect.Map:
+			key, err := parseKey(text, typ.Key())
+			if err != nil {
+				panic(fmt.Sprintf("invalid key %s for type %s", desc, typ))
+			}
+			fs.steps = append(fs.steps, fieldStep{kind: stepKey, desc: desc, key: key})
+
+			// Only some map values can be modified in place
+			if elem := typ.Elem().Kind(); i < len(parts)-1 && elem != reflect.Ptr && elem != reflect.Map && elem != reflect.Slice {
+				panic(fmt.Sprintf("cannot set field through map value %s of type %s", desc, typ.Elem()))
+			}
+
+		case reflect.Invalid, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String,
+			reflect.Chan, reflect.Func, reflect.Interface, reflect.Ptr, reflect.Struct, reflect.UnsafePointer:
+			panic(fmt.Sprintf("cannot index %s of type %s", desc, typ))
+		}
+		typ = typ.Elem()
+	}
+
+	return typ
+}
+
+// deref follows pointers, panicking if a nil pointer is encountered.
+func (fs *FieldSetter) deref(v reflect.Value, desc string) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			panic(fmt.Sprintf("cannot set field %s: nil pointer at %q", fs.path, desc))
+		}
+		v = v.Elem()
+	}
+
+	return v
+}
+
+// resolve walks the field path.  If the last step is a map key, it
+// returns the map; otherwise, it returns the field itself.
+func (fs *FieldSetter) resolve() reflect.Value {
+	v := fs.variable
+	desc := ""
+	for i, step := range fs.steps {
+		v = fs.deref(v, desc)
+
+		switch step.kind {
+		case stepField:
+			for _, idx := range step.field {
+				v = fs.deref(v, desc).Field(idx)
+				if !v.CanSet() && fs.unexported {
+					v = reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem() //nolint:gosec // opt-in with AllowUnexported
+				}
+			}
+
+		case stepIndex:
+			if step.index >= v.Len() {
+				panic(fmt.Sprintf("cannot set field %s: index out of range at %q", fs.path, step.desc))
+			}
+			v = v.Index(step.index)
+
+		case stepKey:
+			if v.IsNil() {
+				panic(fmt.Sprintf("cannot set field %s: nil map at %q", fs.path, desc))
+			}
+			if i == len(fs.steps)-1 {
+				return v
+			}
+			elem := v.MapIndex(step.key)
+			if !elem.IsValid() {
+				panic(fmt.Sprintf("cannot set field %s: missing key at %q", fs.path, step.desc))
+			}
+			v = elem
+		}
+
+		desc = step.desc
+	}
+
+	if !v.CanSet() {
+		panic(fmt.Sprintf("cannot set field %s", fs.path))
+	}
+
+	return v
+}
+
+// mapLeaf tests whether the last step of the field path is a map key.
+func (fs *FieldSetter) mapLeaf() (reflect.Value, bool) {
+	last := fs.steps[len(fs.steps)-1]
+	return last.key, last.kind == stepKey
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (fs *FieldSetter) Install() Patcher {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	// Be idempotent
+	if fs.applied {
+		return fs
+	}
+
+	// Find the field and save its current value
+	fs.target = fs.resolve()
+	if key, ok := fs.mapLeaf(); ok {
+		fs.original = fs.target.MapIndex(key)
+		fs.present = fs.original.IsValid()
+		fs.target.SetMapIndex(key, fs.value)
+	} else {
+		fs.original = reflect.New(fs.target.Type()).Elem()
+		fs.original.Set(fs.target)
+		fs.target.Set(fs.value)
+	}
+	fs.applied = true
+
+	return fs
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (fs *FieldSetter) Restore() Patcher {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	// Be idempotent
+	if !fs.applied {
+		return fs
+	}
+
+	// Restore the field's original value; a map entry that was not
+	// present is deleted
+	if key, ok := fs.mapLeaf(); ok {
+		fs.target.SetMapIndex(key, fs.original)
+	} else {
+		fs.target.Set(fs.original)
+	}
+	fs.target = reflect.Value{}
+	fs.original = reflect.Value{}
+	fs.applied = false
+
+	return fs
+}
+
+// Global implements GlobalPatcher.  The struct a FieldSetter patches
+// may just as easily be local to a test as a package-level
+// configuration, and the path may pass through pointers and maps
+// shared with other code, so a FieldSetter cannot tell whether the
+// field is process-global state; it conservatively reports that it
+// is.
+func (fs *FieldSetter) Global() bool {
+	return true
+}
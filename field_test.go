@@ -0,0 +1,354 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fieldTLS struct {
+	Port int
+	Cert *string
+}
+
+type fieldServer struct {
+	Host string
+	TLS  fieldTLS
+}
+
+type fieldEmbedded struct {
+	Debug bool
+}
+
+type fieldConfig struct {
+	fieldEmbedded
+	Server   fieldServer
+	Backup   *fieldServer
+	Servers  []fieldServer
+	Ports    [2]int
+	Limits   map[string]int
+	Peers    map[int]*fieldServer
+	Tags     map[string][]string
+	Value    interface{}
+	password string
+}
+
+func newFieldConfig() fieldConfig {
+	return fieldConfig{
+		Server:   fieldServer{Host: "localhost", TLS: fieldTLS{Port: 443}},
+		Backup:   &fieldServer{Host: "backup"},
+		Servers:  []fieldServer{{Host: "one"}, {Host: "two"}},
+		Ports:    [2]int{80, 443},
+		Limits:   map[string]int{"conns": 10, "a]b": 1},
+		Peers:    map[int]*fieldServer{1: {Host: "peer"}},
+		Tags:     map[string][]string{"env": {"prod"}},
+		password: "secret",
+	}
+}
+
+func TestFieldSetterImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*GlobalPatcher)(nil), &FieldSetter{})
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		result []string
+		ok     bool
+	}{
+		{"A", []string{"A"}, true},
+		{"A.B.C", []string{"A", "B", "C"}, true},
+		{"A[0].B", []string{"A", "[0]", "B"}, true},
+		{"[key][0]", []string{"[key]", "[0]"}, true},
+		{`A["a]b"]`, []string{"A", `["a]b"]`}, true},
+		{"A[]", []string{"A", "[]"}, true},
+		{"", nil, false},
+		{".A", nil, false},
+		{"A.", nil, false},
+		{"A..B", nil, false},
+		{"A[0]B", nil, false},
+		{"A[0", nil, false},
+		{`A["a]`, nil, false},
+		{`A["a"b]`, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			result, ok := splitPath(test.path)
+
+			assert.Equal(t, test.result, result)
+			assert.Equal(t, test.ok, ok)
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	type name string
+	tests := []struct {
+		text   string
+		typ    interface{}
+		result interface{}
+		ok     bool
+	}{
+		{"key", "", "key", true},
+		{`"a]b"`, "", "a]b", true},
+		{`"bad`, "", nil, false},
+		{"key", name(""), name("key"), true},
+		{"-5", 0, -5, true},
+		{"0x10", int8(0), int8(16), true},
+		{"300", int8(0), nil, false},
+		{"5", uint(0), uint(5), true},
+		{"-5", uint(0), nil, false},
+		{"1.5", 0.0, 1.5, true},
+		{"true", false, true, true},
+		{"maybe", false, nil, false},
+		{"key", struct{}{}, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			result, err := parseKey(test.text, reflect.TypeOf(test.typ))
+
+			if test.ok {
+				assert.NoError(t, err)
+				assert.Equal(t, test.result, result.Interface())
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestSetFieldBase(t *testing.T) {
+	config := newFieldConfig()
+
+	result := SetField(&config, "Server.TLS.Port", 8443)
+
+	assert.Equal(t, reflect.ValueOf(&config).Elem(), result.variable)
+	assert.Equal(t, "Server.TLS.Port", result.path)
+	assert.Equal(t, []fieldStep{
+		{kind: stepField, desc: "Server", field: []int{1}},
+		{kind: stepField, desc: "Server.TLS", field: []int{1}},
+		{kind: stepField, desc: "Server.TLS.Port", field: []int{0}},
+	}, result.steps)
+	assert.Equal(t, 8443, result.value.Interface())
+	assert.False(t, result.unexported)
+	assert.False(t, result.applied)
+}
+
+func TestSetFieldPanics(t *testing.T) {
+	config := newFieldConfig()
+	tests := []struct {
+		name     string
+		variable interface{}
+		path     string
+		value    interface{}
+		message  string
+	}{
+		{"not pointer", config, "Server", nil, "cannot set variable passed to SetField!"},
+		{"nil pointer", (*fieldConfig)(nil), "Server", nil, "cannot set variable passed to SetField!"},
+		{"bad path", &config, "Server..Host", "x", `invalid field path "Server..Host"`},
+		{"no field", &config, "Server.Port", 5, "no field Server.Port in type patcher.fieldServer"},
+		{"not struct", &config, "Server.Host.Len", 5, "cannot select field Server.Host.Len of type string"},
+		{"unexported", &config, "password", "x", "cannot set unexported field password"},
+		{"bad index", &config, "Servers[x]", "x", "invalid index Servers[x] for type []patcher.fieldServer"},
+		{"negative index", &config, "Servers[-1]", "x", "invalid index Servers[-1] for type []patcher.fieldServer"},
+		{"array range", &config, "Ports[2]", 5, "invalid index Ports[2] for type [2]int"},
+		{"bad key", &config, "Peers[x]", nil, "invalid key Peers[x] for type map[int]*patcher.fieldServer"},
+		{"map value", &config, "Limits[conns].X", 5, "cannot set field through map value Limits[conns] of type int"},
+		{"not indexable", &config, "Server[0]", 5, "cannot index Server[0] of type patcher.fieldServer"},
+		{"unassignable", &config, "Server.Host", 5, "cannot assign int type to field Server.Host type string"},
+		{"nil value", &config, "Backup", nil, "cannot assign <nil> type to field Backup type *patcher.fieldServer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.PanicsWithValue(t, test.message, func() {
+				SetField(test.variable, test.path, test.value)
+			})
+		})
+	}
+}
+
+func TestFieldSetterInstallRestore(t *testing.T) {
+	cert := "cert"
+	tests := []struct {
+		path  string
+		value interface{}
+		get   func(c *fieldConfig) interface{}
+	}{
+		{"Server.TLS.Port", 8443, func(c *fieldConfig) interface{} { return c.Server.TLS.Port }},
+		{"Server.TLS.Cert", &cert, func(c *fieldConfig) interface{} { return c.Server.TLS.Cert }},
+		{"Backup.Host", "other", func(c *fieldConfig) interface{} { return c.Backup.Host }},
+		{"Servers[1].Host", "three", func(c *fieldConfig) interface{} { return c.Servers[1].Host }},
+		{"Ports[1]", 8443, func(c *fieldConfig) interface{} { return c.Ports[1] }},
+		{"Peers[1].Host", "other", func(c *fieldConfig) interface{} { return c.Peers[1].Host }},
+		{"Tags[env][0]", "test", func(c *fieldConfig) interface{} { return c.Tags["env"][0] }},
+		{"Debug", true, func(c *fieldConfig) interface{} { return c.Debug }},
+		{"Value", "string", func(c *fieldConfig) interface{} { return c.Value }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			config := newFieldConfig()
+			original := test.get(&config)
+			fs := SetField(&config, test.path, test.value)
+
+			result := fs.Install()
+
+			assert.Same(t, fs, result)
+			assert.Equal(t, test.value, test.get(&config))
+			assert.True(t, fs.applied)
+
+			result = fs.Restore()
+
+			assert.Same(t, fs, result)
+			assert.Equal(t, original, test.get(&config))
+			assert.Equal(t, newFieldConfig(), config)
+			assert.False(t, fs.applied)
+		})
+	}
+}
+
+func TestFieldSetterOnlyLeaf(t *testing.T) {
+	config := newFieldConfig()
+	fs := SetField(&config, "Server.TLS.Port", 8443)
+	fs.Install()
+	config.Server.Host = "changed"
+
+	fs.Restore()
+
+	assert.Equal(t, "changed", config.Server.Host)
+	assert.Equal(t, 443, config.Server.TLS.Port)
+}
+
+func TestFieldSetterMapPresent(t *testing.T) {
+	config := newFieldConfig()
+	fs := SetField(&config, "Limits[conns]", 20)
+
+	fs.Install()
+
+	assert.Equal(t, 20, config.Limits["conns"])
+
+	fs.Restore()
+
+	assert.Equal(t, map[string]int{"conns": 10, "a]b": 1}, config.Limits)
+}
+
+func TestFieldSetterMapAbsent(t *testing.T) {
+	config := newFieldConfig()
+	fs := SetField(&config, `Limits["new]"]`, 20)
+
+	fs.Install()
+
+	assert.Equal(t, 20, config.Limits["new]"])
+
+	fs.Restore()
+
+	assert.Equal(t, map[string]int{"conns": 10, "a]b": 1}, config.Limits)
+}
+
+func TestFieldSetterMapVariable(t *testing.T) {
+	variable := map[string]int{"a": 1}
+	fs := SetField(&variable, "[b]", 2)
+
+	fs.Install()
+
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, variable)
+
+	fs.Restore()
+
+	assert.Equal(t, map[string]int{"a": 1}, variable)
+}
+
+func TestFieldSetterUnexported(t *testing.T) {
+	config := newFieldConfig()
+	fs := SetField(&config, "password", "patched", AllowUnexported())
+
+	fs.Install()
+
+	assert.Equal(t, "patched", config.password)
+
+	fs.Restore()
+
+	assert.Equal(t, "secret", config.password)
+}
+
+func TestFieldSetterInstallPanics(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		value   interface{}
+		modify  func(c *fieldConfig)
+		message string
+	}{
+		{"nil pointer", "Backup.Host", "x", func(c *fieldConfig) { c.Backup = nil }, `cannot set field Backup.Host: nil pointer at "Backup"`},
+		{"index range", "Servers[1].Host", "x", func(c *fieldConfig) { c.Servers = nil }, `cannot set field Servers[1].Host: index out of range at "Servers[1]"`},
+		{"nil map", "Limits[x]", 5, func(c *fieldConfig) { c.Limits = nil }, `cannot set field Limits[x]: nil map at "Limits"`},
+		{"missing key", "Peers[2].Host", "x", func(c *fieldConfig) {}, `cannot set field Peers[2].Host: missing key at "Peers[2]"`},
+		{"nil map value", "Peers[1].Host", "x", func(c *fieldConfig) { c.Peers[1] = nil }, `cannot set field Peers[1].Host: nil pointer at "Peers[1]"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newFieldConfig()
+			test.modify(&config)
+			fs := SetField(&config, test.path, test.value)
+
+			assert.PanicsWithValue(t, test.message, func() {
+				fs.Install()
+			})
+			assert.False(t, fs.applied)
+		})
+	}
+}
+
+func TestFieldSetterInstallIdempotent(t *testing.T) {
+	config := newFieldConfig()
+	fs := SetField(&config, "Server.TLS.Port", 8443)
+	fs.applied = true
+
+	result := fs.Install()
+
+	assert.Same(t, fs, result)
+	assert.Equal(t, 443, config.Server.TLS.Port)
+}
+
+func TestFieldSetterRestoreIdempotent(t *testing.T) {
+	config := newFieldConfig()
+	fs := SetField(&config, "Server.TLS.Port", 8443)
+
+	result := fs.Restore()
+
+	assert.Same(t, fs, result)
+	assert.Equal(t, 443, config.Server.TLS.Port)
+}
+
+func TestFieldSetterGlobal(t *testing.T) {
+	config := newFieldConfig()
+
+	assert.True(t, SetField(&config, "Server.Host", "x").Global())
+}
+
+func TestFieldSetterConcurrent(t *testing.T) {
+	config := newFieldConfig()
+
+	hammer(SetField(&config, "Limits[conns]", 20))
+
+	assert.Equal(t, newFieldConfig(), config)
+}
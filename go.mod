@@ -1,12 +1,12 @@
 module github.com/klmitch/patcher
 
-go 1.17
-
-require github.com/stretchr/testify v1.8.1
+go 1.22.0
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/objx v0.5.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/davecgh/go-spew v1.1.1
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/stretchr/testify v1.8.1
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/stretchr/objx v0.5.0 // indirect
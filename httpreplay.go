@@ -0,0 +1,479 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ErrUnmatchedRequest is returned by the transport installed by an
+// HTTPReplayPatcher in replay mode when a request does not match any
+// of the remaining interactions in the cassette.
+var ErrUnmatchedRequest = errors.New("no cassette interaction matches request")
+
+// Redacted is the value that replaces the values of redacted headers
+// in recorded interactions.
+const Redacted = "REDACTED"
+
+// ReplayMode selects whether an HTTPReplayPatcher records requests
+// to a cassette file or replays them from one.
+type ReplayMode int
+
+// Recognized replay modes.
+const (
+	// ModeReplay serves responses from the cassette file.  No
+	// requests are sent over the network.
+	ModeReplay ReplayMode = iota
+
+	// ModeRecord passes requests through to the original
+	// transport and writes the request/response pairs to the
+	// cassette file when the patch is restored.
+	ModeRecord
+)
+
+// RecordedRequest describes a request stored in a cassette.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// RecordedResponse describes a response stored in a cassette.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+// Interaction is a single request/response pair stored in a
+// cassette.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RequestMatcher is a function that determines whether a live request
+// matches a recorded request.  The live request's body is passed
+// separately, since the body of the request itself may only be read
+// once.  Header redaction has already been applied to the live
+// request's headers.
+type RequestMatcher func(req *http.Request, body []byte, rec *RecordedRequest) bool
+
+// MatchMethod is a RequestMatcher that compares the request methods.
+func MatchMethod(req *http.Request, _ []byte, rec *RecordedRequest) bool {
+	return req.Method == rec.Method
+}
+
+// MatchURL is a RequestMatcher that compares the full request URLs.
+func MatchURL(req *http.Request, _ []byte, rec *RecordedRequest) bool {
+	return req.URL.String() == rec.URL
+}
+
+// MatchBody is a RequestMatcher that compares the request bodies.
+func MatchBody(_ *http.Request, body []byte, rec *RecordedRequest) bool {
+	return bytes.Equal(body, rec.Body)
+}
+
+// MatchHeaders returns a RequestMatcher that compares the values of
+// the named headers.
+func MatchHeaders(names ...string) RequestMatcher {
+	return func(req *http.Request, _ []byte, rec *RecordedRequest) bool {
+		for _, name := range names {
+			if !stringsEqual(req.Header.Values(name), rec.Header.Values(name)) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// stringsEqual is a helper that compares two string slices.
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HTTPReplayOption is an option that may be passed to HTTPReplay.
+type HTTPReplayOption func(hp *HTTPReplayPatcher)
+
+// MatchOn is an HTTPReplayOption that replaces the request matchers
+// used in replay mode.  By default, requests are matched on method
+// and URL.
+func MatchOn(matchers ...RequestMatcher) HTTPReplayOption {
+	return func(hp *HTTPReplayPatcher) {
+		hp.matchers = matchers
+	}
+}
+
+// RedactHeaders is an HTTPReplayOption that adds the named headers to
+// the set of headers whose values are replaced with Redacted in the
+// cassette.  By default, the "Authorization", "Proxy-Authorization",
+// "Cookie", and "Set-Cookie" headers are redacted.
+func RedactHeaders(names ...string) HTTPReplayOption {
+	return func(hp *HTTPReplayPatcher) {
+		for _, name := range names {
+			hp.redact[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// ReportUnmatchedTo is an HTTPReplayOption that causes requests that
+// matched no interaction in replay mode to be reported as errors of
+// the specified test when the patch is restored, instead of causing a
+// panic.
+func ReportUnmatchedTo(t testing.TB) HTTPReplayOption {
+	return func(hp *HTTPReplayPatcher) {
+		hp.tb = t
+	}
+}
+
+// defaultRedact is the list of headers that are redacted by default.
+var defaultRedact = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// roundTripFunc is an adaptor allowing a function to be used as an
+// http.RoundTripper.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip executes a single HTTP transaction.
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// HTTPReplayPatcher is a patcher that replaces http.DefaultTransport
+// and the transport of http.DefaultClient with a transport that
+// records interactions to, or replays interactions from, a cassette
+// file.
+type HTTPReplayPatcher struct {
+	lock          sync.Mutex
+	path          string
+	mode          ReplayMode
+	matchers      []RequestMatcher
+	redact        map[string]bool
+	interactions  []Interaction
+	used          []bool
+	unmatched     []string
+	tb            testing.TB
+	origTransport http.RoundTripper
+	origClient    http.RoundTripper
+	applied       bool
+}
+
+// Patch points for testing the routines in this file.
+var (
+	readFile  = os.ReadFile
+	writeFile = os.WriteFile
+)
+
+// HTTPReplay constructs an HTTPReplayPatcher, storing the path to the
+// cassette file and the mode.  In ModeRecord, requests are passed to
+// the original http.DefaultTransport, or, for requests sent by
+// http.DefaultClient, to the client's original transport if it had
+// one, and the interactions are written to the cassette file when the
+// patch is restored; in ModeReplay, the cassette file is read when the
+// patch is installed and requests are answered from it, each
+// interaction being used at most once.  A request that matches no
+// unused interaction fails with an error wrapping
+// ErrUnmatchedRequest; since the code under test may ignore that
+// error, the unmatched requests are also reported when the patch is
+// restored, by a panic or, if the ReportUnmatchedTo option is given,
+// as errors of the test.  Errors reading or writing the cassette file
+// cause a panic.  It could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer HTTPReplay("testdata/something.json", ModeReplay).Install().Restore()
+//
+//		err := DoSomething("https://example.com/")
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func HTTPReplay(path string, mode ReplayMode, opts ...HTTPReplayOption) *HTTPReplayPatcher {
+	hp := &HTTPReplayPatcher{
+		path:     path,
+		mode:     mode,
+		matchers: []RequestMatcher{MatchMethod, MatchURL},
+		redact:   map[string]bool{},
+	}
+	RedactHeaders(defaultRedact...)(hp)
+
+	for _, opt := range opts {
+		opt(hp)
+	}
+
+	return hp
+}
+
+// Interactions returns a copy of the interactions recorded so far, in
+// record mode, or loaded from the cassette, in replay mode.
+func (hp *HTTPReplayPatcher) Interactions() []Interaction {
+	hp.lock.Lock()
+	defer hp.lock.Unlock()
+
+	return append([]Interaction(nil), hp.interactions...)
+}
+
+// redactHeader returns a copy of the header with the values of the
+// redacted headers replaced.
+func (hp *HTTPReplayPatcher) redactHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	result := header.Clone()
+	for name, values := range result {
+		if hp.redact[name] {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+
+	return result
+}
+
+// readBody is a helper that reads and closes a body, returning the
+// data.  A nil body results in nil data.
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// recorder returns the transport used in record mode.  The transport
+// for http.DefaultClient passes requests to the client's original
+// transport, if it had one.
+func (hp *HTTPReplayPatcher) recorder(client bool) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return hp.record(req, client)
+	})
+}
+
+// record records a request in record mode, passing it to the original
+// transport of http.DefaultClient if client is true and it had one,
+// or to the original http.DefaultTransport otherwise.
+func (hp *HTTPReplayPatcher) record(req *http.Request, client bool) (*http.Response, error) {
+	// Grab the request body and make it available again
+	reqBody, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	// Send the request
+	hp.lock.Lock()
+	transport := hp.origTransport
+	if client && hp.origClient != nil {
+		transport = hp.origClient
+	}
+	hp.lock.Unlock()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Grab the response body and make it available again
+	respBody, err := readBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	hp.lock.Lock()
+	defer hp.lock.Unlock()
+	hp.interactions = append(hp.interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: hp.redactHeader(req.Header),
+			Body:   reqBody,
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     hp.redactHeader(resp.Header),
+			Body:       respBody,
+		},
+	})
+
+	return resp, nil
+}
+
+// replay is the transport used in replay mode.
+func (hp *HTTPReplayPatcher) replay(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Matchers see the request with its headers redacted
+	matchReq := req.Clone(req.Context())
+	matchReq.Header = hp.redactHeader(req.Header)
+
+	hp.lock.Lock()
+	defer hp.lock.Unlock()
+	for i := range hp.interactions {
+		if hp.used[i] || !hp.matches(matchReq, body, &hp.interactions[i].Request) {
+			continue
+		}
+		hp.used[i] = true
+
+		rec := hp.interactions[i].Response
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", rec.StatusCode, http.StatusText(rec.StatusCode)),
+			StatusCode:    rec.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        rec.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(rec.Body)),
+			ContentLength: int64(len(rec.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	hp.unmatched = append(hp.unmatched, fmt.Sprintf("%s %s", req.Method, req.URL))
+
+	return nil, fmt.Errorf("%w: %s %s (cassette %s)", ErrUnmatchedRequest, req.Method, req.URL, hp.path)
+}
+
+// matches is a helper that applies all the matchers to a request.
+func (hp *HTTPReplayPatcher) matches(req *http.Request, body []byte, rec *RecordedRequest) bool {
+	for _, matcher := range hp.matchers {
+		if !matcher(req, body, rec) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (hp *HTTPReplayPatcher) Install() Patcher {
+	hp.lock.Lock()
+	defer hp.lock.Unlock()
+
+	// Be idempotent
+	if hp.applied {
+		return hp
+	}
+
+	// Select the transports, loading the cassette if needed
+	var transport, clientTransport http.RoundTripper
+	hp.interactions = nil
+	if hp.mode == ModeRecord {
+		transport = hp.recorder(false)
+		clientTransport = hp.recorder(true)
+	} else {
+		data, err := readFile(hp.path)
+		if err != nil {
+			panic(err)
+		}
+		if err := json.Unmarshal(data, &hp.interactions); err != nil {
+			panic(fmt.Errorf("cassette %s: %w", hp.path, err))
+		}
+		transport = roundTripFunc(hp.replay)
+		clientTransport = transport
+	}
+	hp.used = make([]bool, len(hp.interactions))
+	hp.unmatched = nil
+
+	// Save the current transports and set the new ones
+	hp.origTransport = http.DefaultTransport
+	hp.origClient = http.DefaultClient.Transport
+	http.DefaultTransport = transport
+	http.DefaultClient.Transport = clientTransport
+	hp.applied = true
+
+	return hp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (hp *HTTPReplayPatcher) Restore() Patcher {
+	hp.lock.Lock()
+	defer hp.lock.Unlock()
+
+	// Be idempotent
+	if !hp.applied {
+		return hp
+	}
+
+	// Restore the original transports
+	http.DefaultTransport = hp.origTransport
+	http.DefaultClient.Transport = hp.origClient
+	hp.applied = false
+
+	// Save the cassette if we were recording
+	if hp.mode == ModeRecord {
+		data, err := json.MarshalIndent(hp.interactions, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		if err := writeFile(hp.path, append(data, '\n'), 0o666); err != nil {
+			panic(err)
+		}
+	}
+
+	// Report any unmatched requests
+	if len(hp.unmatched) > 0 {
+		err := fmt.Errorf("%w (cassette %s):\n\t%s", ErrUnmatchedRequest, hp.path, strings.Join(hp.unmatched, "\n\t"))
+		if hp.tb == nil {
+			panic(err)
+		}
+		hp.tb.Helper()
+		hp.tb.Error(err)
+	}
+
+	return hp
+}
+
+// Global implements GlobalPatcher.  An HTTPReplayPatcher always
+// touches process-global state, since it replaces
+// http.DefaultTransport.
+func (hp *HTTPReplayPatcher) Global() bool {
+	return true
+}
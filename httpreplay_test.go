@@ -0,0 +1,390 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPReplayPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*Patcher)(nil), &HTTPReplayPatcher{})
+}
+
+func TestMatchMethod(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+
+	assert.True(t, MatchMethod(req, nil, &RecordedRequest{Method: http.MethodGet}))
+	assert.False(t, MatchMethod(req, nil, &RecordedRequest{Method: http.MethodPost}))
+}
+
+func TestMatchURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/a?b=c", nil)
+
+	assert.True(t, MatchURL(req, nil, &RecordedRequest{URL: "http://example.com/a?b=c"}))
+	assert.False(t, MatchURL(req, nil, &RecordedRequest{URL: "http://example.com/a"}))
+}
+
+func TestMatchBody(t *testing.T) {
+	assert.True(t, MatchBody(nil, []byte("body"), &RecordedRequest{Body: []byte("body")}))
+	assert.False(t, MatchBody(nil, []byte("body"), &RecordedRequest{Body: []byte("other")}))
+}
+
+func TestMatchHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("X-One", "one")
+	req.Header.Set("X-Two", "two")
+	matcher := MatchHeaders("x-one")
+
+	assert.True(t, matcher(req, nil, &RecordedRequest{Header: http.Header{"X-One": {"one"}}}))
+	assert.False(t, matcher(req, nil, &RecordedRequest{Header: http.Header{"X-One": {"other"}}}))
+	assert.False(t, matcher(req, nil, &RecordedRequest{}))
+}
+
+func TestHTTPReplayBase(t *testing.T) {
+	result := HTTPReplay("cassette.json", ModeRecord)
+
+	assert.Equal(t, "cassette.json", result.path)
+	assert.Equal(t, ModeRecord, result.mode)
+	assert.Len(t, result.matchers, 2)
+	assert.Equal(t, map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+	}, result.redact)
+	assert.False(t, result.applied)
+}
+
+func TestHTTPReplayOptions(t *testing.T) {
+	result := HTTPReplay("cassette.json", ModeReplay, MatchOn(MatchBody), RedactHeaders("x-api-key"), ReportUnmatchedTo(t))
+
+	assert.Equal(t, ModeReplay, result.mode)
+	assert.Same(t, t, result.tb)
+	assert.Len(t, result.matchers, 1)
+	assert.True(t, result.redact["X-Api-Key"])
+	assert.True(t, result.redact["Authorization"])
+}
+
+type errorTB struct {
+	fakeTB
+	errors []string
+}
+
+func (tb *errorTB) Error(args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprint(args...))
+}
+
+func newReplayServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("X-Echo", string(body))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello " + r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestHTTPReplayRecord(t *testing.T) {
+	srv := newReplayServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	origTransport := http.DefaultTransport
+	origClient := http.DefaultClient.Transport
+	hp := HTTPReplay(path, ModeRecord)
+
+	result := hp.Install()
+	assert.Same(t, hp, result)
+	assert.True(t, hp.applied)
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/path", strings.NewReader("request"))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	result = hp.Restore()
+
+	assert.Same(t, hp, result)
+	assert.False(t, hp.applied)
+	assert.Equal(t, "hello /path", string(body))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, origTransport, http.DefaultTransport)
+	assert.Equal(t, origClient, http.DefaultClient.Transport)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	interactions := []Interaction{}
+	require.NoError(t, json.Unmarshal(data, &interactions))
+	require.Len(t, interactions, 1)
+	assert.Equal(t, http.MethodPost, interactions[0].Request.Method)
+	assert.Equal(t, srv.URL+"/path", interactions[0].Request.URL)
+	assert.Equal(t, "request", string(interactions[0].Request.Body))
+	assert.Equal(t, Redacted, interactions[0].Request.Header.Get("Authorization"))
+	assert.Equal(t, http.StatusCreated, interactions[0].Response.StatusCode)
+	assert.Equal(t, Redacted, interactions[0].Response.Header.Get("Set-Cookie"))
+	assert.Equal(t, "request", interactions[0].Response.Header.Get("X-Echo"))
+	assert.Equal(t, "hello /path", string(interactions[0].Response.Body))
+}
+
+func TestHTTPReplayRecordClientTransport(t *testing.T) {
+	srv := newReplayServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	clientCalls := 0
+	base := http.DefaultTransport
+	defer SetVar(&http.DefaultClient.Transport, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		clientCalls++
+		return base.RoundTrip(req)
+	})).Install().Restore()
+	hp := HTTPReplay(path, ModeRecord)
+	hp.Install()
+
+	resp, err := http.DefaultClient.Get(srv.URL + "/client")
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = http.Get(srv.URL + "/other")
+	require.NoError(t, err)
+	resp.Body.Close()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/transport", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	hp.Restore()
+
+	assert.Equal(t, 2, clientCalls)
+	assert.Len(t, hp.Interactions(), 3)
+}
+
+func TestHTTPReplayRecordTransportError(t *testing.T) {
+	hp := HTTPReplay("cassette.json", ModeRecord)
+	hp.origTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, assert.AnError
+	})
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+
+	resp, err := hp.record(req, false)
+
+	assert.Nil(t, resp)
+	assert.Same(t, assert.AnError, err)
+	assert.Empty(t, hp.Interactions())
+}
+
+func TestHTTPReplayRecordWriteFails(t *testing.T) {
+	defer SetVar(&writeFile, func(name string, data []byte, perm os.FileMode) error {
+		return assert.AnError
+	}).Install().Restore()
+	hp := HTTPReplay("cassette.json", ModeRecord)
+	hp.Install()
+
+	assert.PanicsWithValue(t, assert.AnError, func() { hp.Restore() })
+	assert.False(t, hp.applied)
+}
+
+func writeCassette(t *testing.T, interactions []Interaction) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	data, err := json.Marshal(interactions)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return path
+}
+
+func TestHTTPReplayReplay(t *testing.T) {
+	path := writeCassette(t, []Interaction{
+		{
+			Request: RecordedRequest{
+				Method: http.MethodGet,
+				URL:    "http://example.com/one",
+			},
+			Response: RecordedResponse{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"X-Test": {"one"}},
+				Body:       []byte("first"),
+			},
+		},
+		{
+			Request: RecordedRequest{
+				Method: http.MethodGet,
+				URL:    "http://example.com/one",
+			},
+			Response: RecordedResponse{
+				StatusCode: http.StatusNotFound,
+				Body:       []byte("second"),
+			},
+		},
+	})
+	tb := &errorTB{fakeTB: fakeTB{TB: t}}
+	hp := HTTPReplay(path, ModeReplay, ReportUnmatchedTo(tb))
+	hp.Install()
+
+	resp1, err1 := http.Get("http://example.com/one")
+	resp2, err2 := http.Get("http://example.com/one")
+	resp3, err3 := http.Get("http://example.com/one")
+	hp.Restore()
+
+	require.NoError(t, err1)
+	body1, _ := io.ReadAll(resp1.Body)
+	resp1.Body.Close()
+	assert.Equal(t, http.StatusOK, resp1.StatusCode)
+	assert.Equal(t, "200 OK", resp1.Status)
+	assert.Equal(t, "one", resp1.Header.Get("X-Test"))
+	assert.Equal(t, "first", string(body1))
+	require.NoError(t, err2)
+	body2, _ := io.ReadAll(resp2.Body)
+	resp2.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp2.StatusCode)
+	assert.Equal(t, "second", string(body2))
+	assert.Nil(t, resp3)
+	assert.ErrorIs(t, err3, ErrUnmatchedRequest)
+	assert.Equal(t, []string{"no cassette interaction matches request (cassette " + path + "):\n\tGET http://example.com/one"}, tb.errors)
+}
+
+func TestHTTPReplayReplayUnmatchedPanics(t *testing.T) {
+	path := writeCassette(t, []Interaction{})
+	origTransport := http.DefaultTransport
+	hp := HTTPReplay(path, ModeReplay)
+	hp.Install()
+
+	_, err := http.Get("http://example.com/one")
+
+	assert.ErrorIs(t, err, ErrUnmatchedRequest)
+	assert.Panics(t, func() { hp.Restore() })
+	assert.False(t, hp.applied)
+	assert.Equal(t, origTransport, http.DefaultTransport)
+}
+
+func TestHTTPReplayReplayUnmatchedReset(t *testing.T) {
+	path := writeCassette(t, []Interaction{})
+	tb := &errorTB{fakeTB: fakeTB{TB: t}}
+	hp := HTTPReplay(path, ModeReplay, ReportUnmatchedTo(tb))
+	hp.Install()
+	_, _ = http.Get("http://example.com/one")
+	hp.Restore()
+	tb.errors = nil
+
+	hp.Install()
+	hp.Restore()
+
+	assert.Nil(t, tb.errors)
+}
+
+func TestHTTPReplayReplayMatchers(t *testing.T) {
+	path := writeCassette(t, []Interaction{
+		{
+			Request: RecordedRequest{
+				Method: http.MethodPost,
+				URL:    "http://example.com/",
+				Header: http.Header{"Authorization": {Redacted}},
+				Body:   []byte("other"),
+			},
+			Response: RecordedResponse{StatusCode: http.StatusOK},
+		},
+		{
+			Request: RecordedRequest{
+				Method: http.MethodPost,
+				URL:    "http://example.com/",
+				Header: http.Header{"Authorization": {Redacted}},
+				Body:   []byte("body"),
+			},
+			Response: RecordedResponse{StatusCode: http.StatusAccepted},
+		},
+	})
+	hp := HTTPReplay(path, ModeReplay, MatchOn(MatchMethod, MatchURL, MatchBody, MatchHeaders("Authorization")))
+	defer hp.Install().Restore()
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/", bytes.NewReader([]byte("body")))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Len(t, hp.Interactions(), 2)
+}
+
+func TestHTTPReplayReplayReadFails(t *testing.T) {
+	defer SetVar(&readFile, func(name string) ([]byte, error) {
+		return nil, assert.AnError
+	}).Install().Restore()
+	origTransport := http.DefaultTransport
+	hp := HTTPReplay("cassette.json", ModeReplay)
+
+	assert.PanicsWithValue(t, assert.AnError, func() { hp.Install() })
+	assert.False(t, hp.applied)
+	assert.Equal(t, origTransport, http.DefaultTransport)
+}
+
+func TestHTTPReplayReplayBadCassette(t *testing.T) {
+	defer SetVar(&readFile, func(name string) ([]byte, error) {
+		return []byte("not json"), nil
+	}).Install().Restore()
+	hp := HTTPReplay("cassette.json", ModeReplay)
+
+	assert.Panics(t, func() { hp.Install() })
+	assert.False(t, hp.applied)
+}
+
+func TestHTTPReplayPatcherInstallIdempotent(t *testing.T) {
+	origTransport := http.DefaultTransport
+	hp := HTTPReplay("cassette.json", ModeRecord)
+	hp.applied = true
+
+	result := hp.Install()
+
+	assert.Same(t, hp, result)
+	assert.Equal(t, origTransport, http.DefaultTransport)
+	assert.True(t, hp.applied)
+}
+
+func TestHTTPReplayPatcherRestoreIdempotent(t *testing.T) {
+	origTransport := http.DefaultTransport
+	hp := HTTPReplay("cassette.json", ModeRecord)
+
+	result := hp.Restore()
+
+	assert.Same(t, hp, result)
+	assert.Equal(t, origTransport, http.DefaultTransport)
+	assert.False(t, hp.applied)
+}
+
+func TestHTTPReplayPatcherConcurrent(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer SetVar(&readFile, func(string) ([]byte, error) {
+		return []byte("[]"), nil
+	}).Install().Restore()
+
+	hammer(HTTPReplay("cassette.json", ModeReplay))
+
+	assert.Same(t, originalTransport, http.DefaultTransport)
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// ServerOption is an option that may be passed to HTTPServer.  Most
+// options describe targets that receive the URL of the server.
+type ServerOption func(sp *ServerPatcher)
+
+// URLVar is a ServerOption that sets a string variable to the URL of
+// the server while the patch is installed.
+func URLVar(variable *string) ServerOption {
+	return func(sp *ServerPatcher) {
+		sp.targets = append(sp.targets, func(url string) Patcher {
+			return SetVar(variable, url)
+		})
+	}
+}
+
+// URLEnv is a ServerOption that sets an environment variable to the
+// URL of the server while the patch is installed.
+func URLEnv(name string) ServerOption {
+	return func(sp *ServerPatcher) {
+		sp.targets = append(sp.targets, func(url string) Patcher {
+			return SetEnv(name, url)
+		})
+	}
+}
+
+// TLS is a ServerOption that starts the server with TLS.  The
+// transports of the specified clients, or of http.DefaultClient if
+// none are specified, are replaced with a transport that trusts the
+// server's test certificate while the patch is installed.
+func TLS(clients ...*http.Client) ServerOption {
+	return func(sp *ServerPatcher) {
+		sp.tls = true
+		if len(clients) == 0 {
+			clients = []*http.Client{http.DefaultClient}
+		}
+		sp.clients = append(sp.clients, clients...)
+	}
+}
+
+// ServerPatcher is a patcher that starts an httptest.Server when
+// installed and closes it when restored.  While installed, the URL of
+// the server is written into the configured targets.
+type ServerPatcher struct {
+	lock    sync.Mutex
+	handler http.Handler
+	targets []func(url string) Patcher
+	tls     bool
+	clients []*http.Client
+	server  *httptest.Server
+	patches *PatchMaster
+	applied bool
+}
+
+// HTTPServer constructs a ServerPatcher, storing the handler for the
+// server and the options, which describe where to write the URL of
+// the server.  It could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer HTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			fmt.Fprint(w, "hello")
+//		}), URLVar(&baseURL)).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func HTTPServer(handler http.Handler, opts ...ServerOption) *ServerPatcher {
+	sp := &ServerPatcher{
+		handler: handler,
+	}
+
+	for _, opt := range opts {
+		opt(sp)
+	}
+
+	return sp
+}
+
+// Server returns the running server.  It returns nil if the patch is
+// not installed.
+func (sp *ServerPatcher) Server() *httptest.Server {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	return sp.server
+}
+
+// URL returns the URL of the running server.  It returns the empty
+// string if the patch is not installed.
+func (sp *ServerPatcher) URL() string {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	if sp.server == nil {
+		return ""
+	}
+
+	return sp.server.URL
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (sp *ServerPatcher) Install() Patcher {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	// Be idempotent
+	if sp.applied {
+		return sp
+	}
+
+	// Start the server
+	sp.server = httptest.NewUnstartedServer(sp.handler)
+	if sp.tls {
+		sp.server.StartTLS()
+	} else {
+		sp.server.Start()
+	}
+
+	// Point the targets at the server
+	sp.patches = NewPatchMaster()
+	for _, target := range sp.targets {
+		sp.patches.Add(target(sp.server.URL))
+	}
+	for _, client := range sp.clients {
+		sp.patches.Add(SetVar(&client.Transport, sp.server.Client().Transport))
+	}
+	sp.patches.Install()
+	sp.applied = true
+
+	return sp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (sp *ServerPatcher) Restore() Patcher {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	// Be idempotent
+	if !sp.applied {
+		return sp
+	}
+
+	// Restore the targets and shut down the server
+	sp.patches.Restore()
+	sp.server.Close()
+	sp.patches = nil
+	sp.server = nil
+	sp.applied = false
+
+	return sp
+}
+
+// Global implements GlobalPatcher.  A ServerPatcher is assumed to
+// touch process-global state, since it writes the URL of the server
+// into variables, environment variables, and HTTP clients.
+func (sp *ServerPatcher) Global() bool {
+	return true
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*Patcher)(nil), &ServerPatcher{})
+}
+
+var helloHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, "hello")
+})
+
+func TestHTTPServerBase(t *testing.T) {
+	result := HTTPServer(helloHandler)
+
+	assert.NotNil(t, result.handler)
+	assert.Empty(t, result.targets)
+	assert.False(t, result.tls)
+	assert.Empty(t, result.clients)
+	assert.Nil(t, result.Server())
+	assert.Equal(t, "", result.URL())
+	assert.False(t, result.applied)
+}
+
+func TestHTTPServerOptions(t *testing.T) {
+	variable := ""
+	client := &http.Client{}
+
+	result := HTTPServer(helloHandler, URLVar(&variable), URLEnv("SERVER_URL"), TLS(client))
+
+	assert.Len(t, result.targets, 2)
+	assert.True(t, result.tls)
+	assert.Equal(t, []*http.Client{client}, result.clients)
+}
+
+func TestHTTPServerTLSDefaultClient(t *testing.T) {
+	result := HTTPServer(helloHandler, TLS())
+
+	assert.True(t, result.tls)
+	assert.Equal(t, []*http.Client{http.DefaultClient}, result.clients)
+}
+
+func TestServerPatcherInstallRestore(t *testing.T) {
+	variable := "unpatched"
+	defer UnsetEnv("PATCHER_SERVER_URL").Install().Restore()
+	sp := HTTPServer(helloHandler, URLVar(&variable), URLEnv("PATCHER_SERVER_URL"))
+
+	result := sp.Install()
+
+	assert.Same(t, sp, result)
+	assert.True(t, sp.applied)
+	assert.True(t, strings.HasPrefix(sp.URL(), "http://"))
+	assert.Equal(t, sp.URL(), variable)
+	assert.Equal(t, sp.URL(), os.Getenv("PATCHER_SERVER_URL"))
+	resp, err := http.Get(variable + "/")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+	url := sp.URL()
+
+	result = sp.Restore()
+
+	assert.Same(t, sp, result)
+	assert.False(t, sp.applied)
+	assert.Nil(t, sp.Server())
+	assert.Equal(t, "unpatched", variable)
+	_, ok := os.LookupEnv("PATCHER_SERVER_URL")
+	assert.False(t, ok)
+	_, err = http.Get(url + "/")
+	assert.Error(t, err)
+}
+
+func TestServerPatcherInstallRestoreTLS(t *testing.T) {
+	variable := ""
+	client := &http.Client{}
+	sp := HTTPServer(helloHandler, URLVar(&variable), TLS(client))
+
+	sp.Install()
+
+	assert.True(t, strings.HasPrefix(variable, "https://"))
+	assert.NotNil(t, client.Transport)
+	resp, err := client.Get(variable + "/")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+
+	sp.Restore()
+
+	assert.Nil(t, client.Transport)
+	assert.Equal(t, "", variable)
+}
+
+func TestServerPatcherInstallIdempotent(t *testing.T) {
+	sp := HTTPServer(helloHandler)
+	sp.applied = true
+
+	result := sp.Install()
+
+	assert.Same(t, sp, result)
+	assert.Nil(t, sp.Server())
+	assert.True(t, sp.applied)
+}
+
+func TestServerPatcherRestoreIdempotent(t *testing.T) {
+	sp := HTTPServer(helloHandler)
+
+	result := sp.Restore()
+
+	assert.Same(t, sp, result)
+	assert.False(t, sp.applied)
+}
+
+func TestServerPatcherConcurrent(t *testing.T) {
+	baseURL := ""
+	sp := HTTPServer(helloHandler, URLVar(&baseURL))
+
+	hammer(sp)
+
+	assert.Equal(t, "", baseURL)
+	assert.Nil(t, sp.Server())
+	assert.Equal(t, "", sp.URL())
+}
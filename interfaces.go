@@ -28,6 +28,12 @@
 // This package provides several implementations of Patcher, including
 // MockPatcher, which is provided for testing code that manipulates a
 // Patcher; most users of this package will not find this type useful.
+// All the patchers provided by this package are safe for concurrent
+// use: Install, Restore, and PatchMaster.Add may be called from
+// multiple goroutines, such as from a cleanup goroutine.  Note that
+// this only protects the state of the patcher itself; code reading a
+// patched variable must still synchronize with the installation and
+// restoration of the patch.
 package patcher
 
 // Patcher is an interface for patchers.  Patchers have Install and
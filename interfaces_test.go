@@ -0,0 +1,36 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import "sync"
+
+// hammer installs and restores a patcher from several goroutines at
+// once, leaving it restored.  Run under the race detector, it
+// verifies that the patcher is safe for concurrent use.
+func hammer(p Patcher) {
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				p.Install()
+				p.Restore()
+			}
+		}()
+	}
+	wg.Wait()
+	p.Restore()
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// IsolatedEnv is the name of the environment variable used to mark a
+// child process started by RunIsolated.  Its value is the name of the
+// test that should run the isolated function.
+const IsolatedEnv = "PATCHER_ISOLATED_TEST"
+
+// IsolatedResult describes the outcome of a function run by
+// RunIsolated.
+type IsolatedResult struct {
+	ExitCode int    // The exit code of the child process
+	Stdout   string // The standard output of the child process
+	Stderr   string // The standard error of the child process
+}
+
+// Patch points for testing the routines in this file.
+var (
+	execCommand    = exec.Command
+	exit           = os.Exit
+	lookupIsolated = os.LookupEnv
+)
+
+// patchSets contains the patch sets registered with RegisterPatchSet.
+var (
+	patchSetsLock sync.Mutex
+	patchSets     = map[string]*PatchMaster{}
+)
+
+// RegisterPatchSet registers a named set of patches that may be
+// installed in the child process by RunIsolated.  As the child
+// process re-executes the test binary, the set should be registered
+// by code that runs in both processes, such as an init function or
+// the test function itself before it calls RunIsolated.
+func RegisterPatchSet(name string, patches ...Patcher) {
+	patchSetsLock.Lock()
+	defer patchSetsLock.Unlock()
+
+	patchSets[name] = NewPatchMaster(patches...)
+}
+
+// lookupPatchSet looks up a registered patch set.
+func lookupPatchSet(name string) (*PatchMaster, bool) {
+	patchSetsLock.Lock()
+	defer patchSetsLock.Unlock()
+
+	pm, ok := patchSets[name]
+	return pm, ok
+}
+
+// runPattern constructs a -test.run pattern that matches exactly the
+// named test.
+func runPattern(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(part) + "$"
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// RunIsolated runs a function in a separate process, for testing
+// code that alters state that cannot be restored, such as calling
+// log.Fatal or defining flags on flag.CommandLine.  The current test
+// binary is re-executed with -test.run pinned to the calling test and
+// the IsolatedEnv environment variable set; in the child process,
+// RunIsolated installs the named patch sets, which must have been
+// registered with RegisterPatchSet, calls the function, and exits
+// with code 0 if the function returns.  In the parent process,
+// RunIsolated returns the exit code, standard output, and standard
+// error of the child.  RunIsolated may be called at most once per
+// test; use subtests to run several isolated functions.  In a child
+// process started for a different test, RunIsolated does not run the
+// function and returns a result with exit code -1.  It could be used
+// in a test function like so:
+//
+//	func TestFatal(t *testing.T) {
+//		result := RunIsolated(t, func() {
+//			log.Fatal("oops")
+//		})
+//
+//		if result.ExitCode != 1 || !strings.Contains(result.Stderr, "oops") {
+//			t.Fail("failed to exit!")
+//		}
+//	}
+func RunIsolated(t testing.TB, fn func(), sets ...string) *IsolatedResult {
+	t.Helper()
+
+	// Are we a child process?
+	if marker, ok := lookupIsolated(IsolatedEnv); ok {
+		if marker == t.Name() {
+			runChild(t, fn, sets)
+		}
+
+		return &IsolatedResult{ExitCode: -1}
+	}
+
+	// Make sure the patch sets exist before going to the trouble
+	// of starting the child
+	for _, set := range sets {
+		if _, ok := lookupPatchSet(set); !ok {
+			t.Fatalf("patch set %q is not registered", set)
+			return nil
+		}
+	}
+
+	// Run the child process
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := execCommand(os.Args[0], "-test.run="+runPattern(t.Name()))
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", IsolatedEnv, t.Name()))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+
+	result := &IsolatedResult{
+		Stdout: stdout.String(),
+		Stderr: stderr.String(),
+	}
+	if err != nil {
+		exitErr := &exec.ExitError{}
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("unable to run isolated test %s: %s", t.Name(), err)
+			return nil
+		}
+		result.ExitCode = exitErr.ExitCode()
+	}
+
+	return result
+}
+
+// runChild runs the isolated function in the child process, then
+// exits.
+func runChild(t testing.TB, fn func(), sets []string) {
+	t.Helper()
+
+	pm := NewPatchMaster()
+	for _, set := range sets {
+		patches, ok := lookupPatchSet(set)
+		if !ok {
+			t.Fatalf("patch set %q is not registered", set)
+			return
+		}
+		pm.Add(patches)
+	}
+
+	pm.Install()
+	fn()
+	pm.Restore()
+
+	exit(0)
+}
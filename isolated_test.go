@@ -0,0 +1,158 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTB struct {
+	testing.TB
+	name  string
+	fatal string
+}
+
+func (f *fakeTB) Name() string {
+	return f.name
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.fatal = fmt.Sprintf(format, args...)
+}
+
+func TestRegisterPatchSet(t *testing.T) {
+	p1 := &MockPatcher{}
+
+	RegisterPatchSet("test-register", p1)
+
+	pm, ok := lookupPatchSet("test-register")
+	assert.True(t, ok)
+	assert.Equal(t, []Patcher{p1}, pm.patches)
+}
+
+func TestRunPattern(t *testing.T) {
+	assert.Equal(t, "^TestA$/^sub\\.test$", runPattern("TestA/sub.test"))
+}
+
+func TestRunIsolatedExit(t *testing.T) {
+	RegisterPatchSet("test-isolated", SetEnv("PATCHER_ISOLATED_VALUE", "patched"))
+
+	result := RunIsolated(t, func() {
+		fmt.Println("value:", os.Getenv("PATCHER_ISOLATED_VALUE"))
+		log.Fatal("fatal error")
+	}, "test-isolated")
+
+	assert.Equal(t, 1, result.ExitCode)
+	assert.Equal(t, "value: patched\n", result.Stdout)
+	assert.Contains(t, result.Stderr, "fatal error")
+	_, ok := os.LookupEnv("PATCHER_ISOLATED_VALUE")
+	assert.False(t, ok)
+}
+
+func TestRunIsolatedReturn(t *testing.T) {
+	t.Run("sub test", func(t *testing.T) {
+		result := RunIsolated(t, func() {
+			fmt.Print("returned")
+		})
+
+		assert.Equal(t, 0, result.ExitCode)
+		assert.Equal(t, "returned", result.Stdout)
+	})
+}
+
+func TestRunIsolatedUnregistered(t *testing.T) {
+	tb := &fakeTB{name: "TestUnregistered"}
+
+	result := RunIsolated(tb, func() {}, "test-unregistered")
+
+	assert.Nil(t, result)
+	assert.Equal(t, `patch set "test-unregistered" is not registered`, tb.fatal)
+}
+
+func TestRunIsolatedExecFails(t *testing.T) {
+	defer SetVar(&execCommand, func(name string, args ...string) *exec.Cmd {
+		return exec.Command("/nonexistent/command")
+	}).Install().Restore()
+	tb := &fakeTB{name: "TestExecFails"}
+
+	result := RunIsolated(tb, func() {})
+
+	assert.Nil(t, result)
+	assert.Contains(t, tb.fatal, "unable to run isolated test TestExecFails")
+}
+
+func TestRunIsolatedChild(t *testing.T) {
+	exitCode := -1
+	defer NewPatchMaster(
+		SetVar(&lookupIsolated, func(name string) (string, bool) {
+			assert.Equal(t, IsolatedEnv, name)
+			return "TestChild", true
+		}),
+		SetVar(&exit, func(code int) {
+			exitCode = code
+		}),
+	).Install().Restore()
+	RegisterPatchSet("test-child", SetEnv("PATCHER_ISOLATED_VALUE", "patched"))
+	tb := &fakeTB{name: "TestChild"}
+	value := ""
+
+	result := RunIsolated(tb, func() {
+		value = os.Getenv("PATCHER_ISOLATED_VALUE")
+	}, "test-child")
+
+	assert.Equal(t, &IsolatedResult{ExitCode: -1}, result)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "patched", value)
+	_, ok := os.LookupEnv("PATCHER_ISOLATED_VALUE")
+	assert.False(t, ok)
+}
+
+func TestRunIsolatedChildUnregistered(t *testing.T) {
+	defer SetVar(&lookupIsolated, func(name string) (string, bool) {
+		return "TestChild", true
+	}).Install().Restore()
+	tb := &fakeTB{name: "TestChild"}
+	called := false
+
+	RunIsolated(tb, func() {
+		called = true
+	}, "test-child-unregistered")
+
+	assert.False(t, called)
+	assert.Equal(t, `patch set "test-child-unregistered" is not registered`, tb.fatal)
+}
+
+func TestRunIsolatedOtherChild(t *testing.T) {
+	defer SetVar(&lookupIsolated, func(name string) (string, bool) {
+		return "TestOther", true
+	}).Install().Restore()
+	tb := &fakeTB{name: "TestChild"}
+	called := false
+
+	result := RunIsolated(tb, func() {
+		called = true
+	})
+
+	assert.Equal(t, &IsolatedResult{ExitCode: -1}, result)
+	assert.False(t, called)
+}
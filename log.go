@@ -17,11 +17,13 @@ package patcher
 import (
 	"io"
 	"log"
+	"sync"
 )
 
 // LogPatcher is a patcher that, given a io.Writer, will update the
 // output of the default logger in the log package.
 type LogPatcher struct {
+	lock     sync.Mutex
 	value    io.Writer
 	original io.Writer
 	applied  bool
@@ -51,6 +53,9 @@ func Log(value io.Writer) *LogPatcher {
 // allow Restore to restore the original data.  This method must be
 // idempotent.
 func (lp *LogPatcher) Install() Patcher {
+	lp.lock.Lock()
+	defer lp.lock.Unlock()
+
 	// Be idempotent
 	if lp.applied {
 		return lp
@@ -69,6 +74,9 @@ func (lp *LogPatcher) Install() Patcher {
 // Restore uses the metadata stored by Install to restore the patch to
 // its original value.  This method must be idempotent.
 func (lp *LogPatcher) Restore() Patcher {
+	lp.lock.Lock()
+	defer lp.lock.Unlock()
+
 	// Be idempotent
 	if !lp.applied {
 		return lp
@@ -80,3 +88,10 @@ func (lp *LogPatcher) Restore() Patcher {
 
 	return lp
 }
+
+// Global implements GlobalPatcher.  The default logger is shared by
+// the whole process, so a LogPatcher always touches process-global
+// state.
+func (lp *LogPatcher) Global() bool {
+	return true
+}
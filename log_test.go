@@ -100,3 +100,11 @@ func TestLogPatcherRestoreIdempotent(t *testing.T) {
 	assert.Same(t, original, log.Writer())
 	assert.False(t, lp.applied)
 }
+
+func TestLogPatcherConcurrent(t *testing.T) {
+	original := log.Writer()
+
+	hammer(Log(&bytes.Buffer{}))
+
+	assert.Same(t, original, log.Writer())
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// MapEntryPatcher is a patcher that, given a pointer to a map
+// variable and a key, will set or delete that entry of the map.
+type MapEntryPatcher struct {
+	lock     sync.Mutex
+	variable reflect.Value
+	key      reflect.Value
+	value    reflect.Value
+	target   reflect.Value
+	original reflect.Value
+	applied  bool
+}
+
+// canBeNil tests whether nil is a valid value for the specified type.
+func canBeNil(typ reflect.Type) bool {
+	kind := typ.Kind()
+
+	return kind == reflect.Chan || kind == reflect.Func || kind == reflect.Interface ||
+		kind == reflect.Map || kind == reflect.Ptr || kind == reflect.Slice
+}
+
+// mapValue converts a key or value for a map entry, checking that it
+// can be assigned to the specified type.  An untyped nil is converted
+// to the zero value of types that can be nil.
+func mapValue(value interface{}, typ reflect.Type, what string) reflect.Value {
+	val := reflect.ValueOf(value)
+	if !val.IsValid() {
+		if canBeNil(typ) {
+			return reflect.Zero(typ)
+		}
+	} else if val.Type().AssignableTo(typ) {
+		return val
+	}
+
+	panic(fmt.Sprintf("cannot assign %T type to map %s type %s", value, what, typ))
+}
+
+// newMapEntryPatcher constructs a MapEntryPatcher, validating the map
+// variable and the key.
+func newMapEntryPatcher(caller string, variable, key interface{}) *MapEntryPatcher {
+	// Select the variable and validate it's a map variable
+	varReflect := reflect.ValueOf(variable)
+	if varReflect.Kind() != reflect.Ptr || varReflect.Elem().Kind() != reflect.Map {
+		panic(fmt.Sprintf("cannot set map passed to %s!", caller))
+	}
+	v := varReflect.Elem()
+
+	return &MapEntryPatcher{
+		variable: v,
+		key:      mapValue(key, v.Type().Key(), "key"),
+	}
+}
+
+// SetMapEntry constructs a MapEntryPatcher, storing the map variable,
+// the key, and the desired value of the map entry.  When the patch is
+// restored, the entry is set back to its original value, or deleted
+// if it was not present; only the entry is touched, and the map is
+// not copied.  The map must not be nil when the patch is installed.
+// It could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer SetMapEntry(&codecs, "json", fakeCodec).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func SetMapEntry(variable, key, value interface{}) *MapEntryPatcher {
+	mp := newMapEntryPatcher("SetMapEntry", variable, key)
+	mp.value = mapValue(value, mp.variable.Type().Elem(), "value")
+
+	return mp
+}
+
+// DeleteMapEntry constructs a MapEntryPatcher.  The specified entry
+// of the map will be deleted when the patch is installed, and put
+// back, if it was present, when the patch is restored.  It could be
+// used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer DeleteMapEntry(&features, "new-parser").Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func DeleteMapEntry(variable, key interface{}) *MapEntryPatcher {
+	return newMapEntryPatcher("DeleteMapEntry", variable, key)
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (mp *MapEntryPatcher) Install() Patcher {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	// Be idempotent
+	if mp.applied {
+		return mp
+	}
+
+	// Refuse to set an entry in a nil map
+	if mp.value.IsValid() && mp.variable.IsNil() {
+		panic(fmt.Sprintf("cannot set map entry %v: nil map", mp.key))
+	}
+
+	// Save the map itself and the current value of the entry; the
+	// original is not valid if the entry is not present
+	mp.target = reflect.New(mp.variable.Type()).Elem()
+	mp.target.Set(mp.variable)
+	mp.original = mp.target.MapIndex(mp.key)
+
+	// Set or delete the entry and store that it's applied
+	if mp.value.IsValid() || mp.original.IsValid() {
+		mp.target.SetMapIndex(mp.key, mp.value)
+	}
+	mp.applied = true
+
+	return mp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.  It will panic
+// if the map variable has been set to a different map since the patch
+// was installed.
+func (mp *MapEntryPatcher) Restore() Patcher {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	// Be idempotent
+	if !mp.applied {
+		return mp
+	}
+
+	// Make sure the entry is restored in the right map
+	if mp.variable.Pointer() != mp.target.Pointer() {
+		panic(fmt.Sprintf("cannot restore map entry %v: map was replaced", mp.key))
+	}
+
+	// Restore the entry's original value, deleting it if it was
+	// not present, and clear the applied flag
+	if mp.value.IsValid() || mp.original.IsValid() {
+		mp.target.SetMapIndex(mp.key, mp.original)
+	}
+	mp.target = reflect.Value{}
+	mp.original = reflect.Value{}
+	mp.applied = false
+
+	return mp
+}
+
+// Global implements GlobalPatcher.  A MapEntryPatcher always touches
+// process-global state, since it changes the map in place, and the
+// change is visible through every copy of the map, not just the
+// variable passed to it.
+func (mp *MapEntryPatcher) Global() bool {
+	return true
+}
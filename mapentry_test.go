@@ -0,0 +1,271 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapEntryPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*GlobalPatcher)(nil), &MapEntryPatcher{})
+}
+
+func TestCanBeNil(t *testing.T) {
+	assert.True(t, canBeNil(reflect.TypeOf(make(chan int))))
+	assert.True(t, canBeNil(reflect.TypeOf(func() {})))
+	assert.True(t, canBeNil(reflect.TypeOf((*error)(nil)).Elem()))
+	assert.True(t, canBeNil(reflect.TypeOf(map[string]int{})))
+	assert.True(t, canBeNil(reflect.TypeOf(&struct{}{})))
+	assert.True(t, canBeNil(reflect.TypeOf([]int{})))
+	assert.False(t, canBeNil(reflect.TypeOf(0)))
+	assert.False(t, canBeNil(reflect.TypeOf("")))
+	assert.False(t, canBeNil(reflect.TypeOf([1]int{})))
+	assert.False(t, canBeNil(reflect.TypeOf(struct{}{})))
+}
+
+func TestMapValueAssignable(t *testing.T) {
+	result := mapValue(5, reflect.TypeOf(0), "value")
+
+	assert.Equal(t, 5, result.Interface())
+}
+
+func TestMapValueInterface(t *testing.T) {
+	result := mapValue(5, reflect.TypeOf((*interface{})(nil)).Elem(), "value")
+
+	assert.Equal(t, 5, result.Interface())
+}
+
+func TestMapValueNil(t *testing.T) {
+	result := mapValue(nil, reflect.TypeOf((*error)(nil)).Elem(), "value")
+
+	assert.Equal(t, reflect.TypeOf((*error)(nil)).Elem(), result.Type())
+	assert.True(t, result.IsNil())
+}
+
+func TestMapValueNilUnassignable(t *testing.T) {
+	assert.PanicsWithValue(t, "cannot assign <nil> type to map value type int", func() {
+		mapValue(nil, reflect.TypeOf(0), "value")
+	})
+}
+
+func TestMapValueUnassignable(t *testing.T) {
+	assert.PanicsWithValue(t, "cannot assign string type to map key type int", func() {
+		mapValue("five", reflect.TypeOf(0), "key")
+	})
+}
+
+func TestSetMapEntry(t *testing.T) {
+	m := map[string]int{}
+
+	result := SetMapEntry(&m, "key", 5)
+
+	assert.Equal(t, reflect.ValueOf(&m).Elem(), result.variable)
+	assert.Equal(t, "key", result.key.Interface())
+	assert.Equal(t, 5, result.value.Interface())
+	assert.False(t, result.applied)
+}
+
+func TestSetMapEntryNotPointer(t *testing.T) {
+	m := map[string]int{}
+
+	assert.PanicsWithValue(t, "cannot set map passed to SetMapEntry!", func() {
+		SetMapEntry(m, "key", 5)
+	})
+}
+
+func TestSetMapEntryNotMap(t *testing.T) {
+	variable := 5
+
+	assert.PanicsWithValue(t, "cannot set map passed to SetMapEntry!", func() {
+		SetMapEntry(&variable, "key", 5)
+	})
+}
+
+func TestSetMapEntryBadValue(t *testing.T) {
+	m := map[string]int{}
+
+	assert.PanicsWithValue(t, "cannot assign string type to map value type int", func() {
+		SetMapEntry(&m, "key", "five")
+	})
+}
+
+func TestDeleteMapEntry(t *testing.T) {
+	m := map[string]int{}
+
+	result := DeleteMapEntry(&m, "key")
+
+	assert.Equal(t, reflect.ValueOf(&m).Elem(), result.variable)
+	assert.Equal(t, "key", result.key.Interface())
+	assert.False(t, result.value.IsValid())
+	assert.False(t, result.applied)
+}
+
+func TestDeleteMapEntryNotMap(t *testing.T) {
+	variable := 5
+
+	assert.PanicsWithValue(t, "cannot set map passed to DeleteMapEntry!", func() {
+		DeleteMapEntry(&variable, "key")
+	})
+}
+
+func TestDeleteMapEntryBadKey(t *testing.T) {
+	m := map[string]int{}
+
+	assert.PanicsWithValue(t, "cannot assign int type to map key type string", func() {
+		DeleteMapEntry(&m, 5)
+	})
+}
+
+func TestMapEntryPatcherSetPresent(t *testing.T) {
+	m := map[string]int{"key": 1, "other": 2}
+	mp := SetMapEntry(&m, "key", 5)
+
+	result := mp.Install()
+
+	assert.Same(t, mp, result)
+	assert.Equal(t, map[string]int{"key": 5, "other": 2}, m)
+	assert.True(t, mp.applied)
+
+	result = mp.Restore()
+
+	assert.Same(t, mp, result)
+	assert.Equal(t, map[string]int{"key": 1, "other": 2}, m)
+	assert.False(t, mp.applied)
+}
+
+func TestMapEntryPatcherSetAbsent(t *testing.T) {
+	m := map[string]int{"other": 2}
+	mp := SetMapEntry(&m, "key", 5)
+
+	mp.Install()
+
+	assert.Equal(t, map[string]int{"key": 5, "other": 2}, m)
+
+	mp.Restore()
+
+	assert.Equal(t, map[string]int{"other": 2}, m)
+}
+
+func TestMapEntryPatcherSetNilValue(t *testing.T) {
+	m := map[string]error{"key": assert.AnError}
+	mp := SetMapEntry(&m, "key", nil)
+
+	mp.Install()
+
+	v, ok := m["key"]
+	assert.Nil(t, v)
+	assert.True(t, ok)
+
+	mp.Restore()
+
+	assert.Same(t, assert.AnError, m["key"])
+}
+
+func TestMapEntryPatcherSetNilMap(t *testing.T) {
+	var m map[string]int
+	mp := SetMapEntry(&m, "key", 5)
+
+	assert.PanicsWithValue(t, "cannot set map entry key: nil map", func() {
+		mp.Install()
+	})
+	assert.False(t, mp.applied)
+}
+
+func TestMapEntryPatcherDeletePresent(t *testing.T) {
+	m := map[string]int{"key": 1, "other": 2}
+	mp := DeleteMapEntry(&m, "key")
+
+	mp.Install()
+
+	assert.Equal(t, map[string]int{"other": 2}, m)
+
+	mp.Restore()
+
+	assert.Equal(t, map[string]int{"key": 1, "other": 2}, m)
+}
+
+func TestMapEntryPatcherDeleteAbsent(t *testing.T) {
+	m := map[string]int{"other": 2}
+	mp := DeleteMapEntry(&m, "key")
+
+	mp.Install()
+
+	assert.Equal(t, map[string]int{"other": 2}, m)
+
+	mp.Restore()
+
+	assert.Equal(t, map[string]int{"other": 2}, m)
+}
+
+func TestMapEntryPatcherDeleteNilMap(t *testing.T) {
+	var m map[string]int
+	mp := DeleteMapEntry(&m, "key")
+
+	mp.Install()
+	mp.Restore()
+
+	assert.Nil(t, m)
+}
+
+func TestMapEntryPatcherInstallIdempotent(t *testing.T) {
+	m := map[string]int{"key": 1}
+	mp := SetMapEntry(&m, "key", 5)
+	mp.applied = true
+
+	result := mp.Install()
+
+	assert.Same(t, mp, result)
+	assert.Equal(t, map[string]int{"key": 1}, m)
+}
+
+func TestMapEntryPatcherRestoreIdempotent(t *testing.T) {
+	m := map[string]int{"key": 1}
+	mp := SetMapEntry(&m, "key", 5)
+
+	result := mp.Restore()
+
+	assert.Same(t, mp, result)
+	assert.Equal(t, map[string]int{"key": 1}, m)
+}
+
+func TestMapEntryPatcherRestoreReplaced(t *testing.T) {
+	m := map[string]int{"key": 1}
+	mp := SetMapEntry(&m, "key", 5)
+	mp.Install()
+	m = map[string]int{}
+
+	assert.PanicsWithValue(t, "cannot restore map entry key: map was replaced", func() {
+		mp.Restore()
+	})
+	assert.True(t, mp.applied)
+	assert.Equal(t, map[string]int{}, m)
+}
+
+func TestMapEntryPatcherGlobal(t *testing.T) {
+	m := map[string]int{}
+
+	assert.True(t, DeleteMapEntry(&m, "key").Global())
+}
+
+func TestMapEntryPatcherConcurrent(t *testing.T) {
+	m := map[string]int{"key": 1}
+
+	hammer(SetMapEntry(&m, "key", 5))
+
+	assert.Equal(t, map[string]int{"key": 1}, m)
+}
@@ -14,10 +14,17 @@
 
 package patcher
 
+import "sync"
+
 // PatchMaster is a patcher that handles multiple patchers.  Patchers
 // can be passed in to the constructor (NewPatchMaster), or can be
-// added using the Add method.
+// added using the Add method.  The methods of a PatchMaster may be
+// called concurrently, but Install and Restore patch the children one
+// at a time without holding a lock across them, so calling Install
+// and Restore on the same PatchMaster concurrently can leave some of
+// the children installed and others restored.
 type PatchMaster struct {
+	lock    sync.Mutex
 	patches []Patcher
 }
 
@@ -42,11 +49,22 @@ func NewPatchMaster(patches ...Patcher) *PatchMaster {
 	return &PatchMaster{patches: patches}
 }
 
+// snapshot returns the current list of patchers.  The lock is only
+// held long enough to copy the slice header; elements are never
+// modified once added, so the patchers may be installed and restored
+// without blocking Add.
+func (pm *PatchMaster) snapshot() []Patcher {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	return pm.patches
+}
+
 // Install installs the patch.  It should store metadata sufficient to
 // allow Restore to restore the original data.  This method must be
 // idempotent.
 func (pm *PatchMaster) Install() Patcher {
-	for _, patch := range pm.patches {
+	for _, patch := range pm.snapshot() {
 		patch.Install()
 	}
 
@@ -57,8 +75,9 @@ func (pm *PatchMaster) Install() Patcher {
 // its original value.  This method must be idempotent.
 func (pm *PatchMaster) Restore() Patcher {
 	// Walk the patches in reverse for the restore
-	for i := len(pm.patches) - 1; i >= 0; i-- {
-		pm.patches[i].Restore()
+	patches := pm.snapshot()
+	for i := len(patches) - 1; i >= 0; i-- {
+		patches[i].Restore()
 	}
 
 	return pm
@@ -67,7 +86,22 @@ func (pm *PatchMaster) Restore() Patcher {
 // Add adds a new patcher to the PatchMaster.  For convenience, it
 // returns the patcher it just added.
 func (pm *PatchMaster) Add(patch Patcher) Patcher {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
 	pm.patches = append(pm.patches, patch)
 
 	return patch
 }
+
+// Global implements GlobalPatcher.  A PatchMaster touches
+// process-global state if any of its patchers do.
+func (pm *PatchMaster) Global() bool {
+	for _, patch := range pm.snapshot() {
+		if IsGlobal(patch) {
+			return true
+		}
+	}
+
+	return false
+}
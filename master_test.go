@@ -16,6 +16,7 @@ package patcher
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -103,3 +104,61 @@ func TestPatchMasterAdd(t *testing.T) {
 	assert.Same(t, p1, pm.patches[0])
 	assert.Same(t, p2, pm.patches[1])
 }
+
+func TestPatchMasterConcurrent(t *testing.T) {
+	variables := make([]string, 20)
+	pm := NewPatchMaster()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range variables {
+			pm.Add(SetVar(&variables[i], "patched"))
+		}
+	}()
+	hammer(pm)
+	wg.Wait()
+	pm.Restore()
+
+	assert.Len(t, pm.patches, len(variables))
+	for _, variable := range variables {
+		assert.Equal(t, "", variable)
+	}
+}
+
+type nopPatcher struct{}
+
+func (np nopPatcher) Install() Patcher {
+	return np
+}
+
+func (np nopPatcher) Restore() Patcher {
+	return np
+}
+
+func BenchmarkPatchMaster(b *testing.B) {
+	b.Run("Add", func(b *testing.B) {
+		pm := NewPatchMaster()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				pm.Add(nopPatcher{})
+			}
+		})
+	})
+
+	b.Run("InstallRestore", func(b *testing.B) {
+		pm := NewPatchMaster()
+		for i := 0; i < 10; i++ {
+			pm.Add(nopPatcher{})
+		}
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				pm.Install()
+				pm.Restore()
+			}
+		})
+	})
+}
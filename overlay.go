@@ -0,0 +1,247 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// overlayKey is the context key for the overlay of a test.
+type overlayKey struct{}
+
+// overlay contains the overridden values of Var variables for a
+// single test, keyed by the Var.
+type overlay struct {
+	lock   sync.RWMutex
+	values map[interface{}]interface{}
+}
+
+// get gets the overridden value of a variable.
+func (o *overlay) get(key interface{}) (interface{}, bool) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	value, ok := o.values[key]
+
+	return value, ok
+}
+
+// set sets the overridden value of a variable, returning the
+// previous value.  If ok is false, the override is removed.
+func (o *overlay) set(key, value interface{}, ok bool) (interface{}, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	prev, prevOK := o.values[key]
+	if ok {
+		o.values[key] = value
+	} else {
+		delete(o.values, key)
+	}
+
+	return prev, prevOK
+}
+
+// overlays contains the overlays of the running tests.
+var overlays = struct {
+	lock  sync.Mutex
+	tests map[testing.TB]*overlay
+}{
+	tests: map[testing.TB]*overlay{},
+}
+
+// overlayFor returns the overlay for a test, creating it if
+// necessary.
+func overlayFor(t testing.TB) *overlay {
+	overlays.lock.Lock()
+	o, ok := overlays.tests[t]
+	if !ok {
+		o = &overlay{values: map[interface{}]interface{}{}}
+		overlays.tests[t] = o
+	}
+	overlays.lock.Unlock()
+
+	if !ok {
+		t.Cleanup(func() {
+			overlays.lock.Lock()
+			defer overlays.lock.Unlock()
+
+			delete(overlays.tests, t)
+		})
+	}
+
+	return o
+}
+
+// OverlayContext returns a context carrying the overrides of Var
+// variables for a test.  Overrides installed or restored later are
+// reflected in the context.  Overrides are not inherited by
+// subtests.
+func OverlayContext(t testing.TB) context.Context {
+	return WithOverlay(context.Background(), t)
+}
+
+// WithOverlay is like OverlayContext, but derives the context from an
+// existing context, such as the context of an HTTP request.
+func WithOverlay(ctx context.Context, t testing.TB) context.Context {
+	return context.WithValue(ctx, overlayKey{}, overlayFor(t))
+}
+
+// Var is a container for a patch point that supports parallel tests.
+// Production code declares a Var instead of a package variable and
+// reads its value with Get, passing a context.  Tests override the
+// value with Override, which binds the override to the test; only
+// code passed a context from OverlayContext or WithOverlay for that
+// test sees the override, so parallel tests see independent values.
+// A Var must not be copied after first use.
+type Var[T any] struct {
+	value T
+}
+
+// NewVar constructs a Var with the specified default value.  It could
+// be used like so:
+//
+//	var readFile = patcher.NewVar(os.ReadFile)
+//
+//	func DoSomething(ctx context.Context, filename string) error {
+//		data, err := readFile.Get(ctx)(filename)
+//		if err != nil {
+//			return err
+//		}
+//
+//		// Do something...
+//
+//		return nil
+//	}
+func NewVar[T any](value T) *Var[T] {
+	return &Var[T]{
+		value: value,
+	}
+}
+
+// Get returns the value of the variable: the override for the test
+// whose overlay is carried by the context, if any, or the default
+// value.  The context may be nil.
+func (v *Var[T]) Get(ctx context.Context) T {
+	if ctx != nil {
+		if o, ok := ctx.Value(overlayKey{}).(*overlay); ok {
+			if value, ok := o.get(v); ok {
+				return value.(T)
+			}
+		}
+	}
+
+	return v.value
+}
+
+// Override overrides the value of the variable for a test, restoring
+// it when the test completes.  It returns the context carrying the
+// test's overrides, as returned by OverlayContext.  It could be used
+// in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		t.Parallel()
+//		ctx := readFile.Override(t, func(filename string) ([]byte, error) {
+//			return []byte("hello"), nil
+//		})
+//
+//		err := DoSomething(ctx, "some-filename")
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func (v *Var[T]) Override(t testing.TB, value T) context.Context {
+	t.Helper()
+
+	op := v.Patch(t, value)
+	t.Cleanup(func() {
+		op.Restore()
+	})
+	op.Install()
+
+	return OverlayContext(t)
+}
+
+// Patch constructs an OverlayPatcher that overrides the value of the
+// variable for a test while it is installed.  It allows overrides to
+// be placed in a PatchMaster; the overrides are visible through the
+// context returned by OverlayContext.
+func (v *Var[T]) Patch(t testing.TB, value T) *OverlayPatcher {
+	return &OverlayPatcher{
+		overlay: overlayFor(t),
+		key:     v,
+		value:   value,
+	}
+}
+
+// OverlayPatcher is a patcher that overrides the value of a Var for a
+// single test.  Since the override is only visible to that test, it
+// does not touch process-global state.
+type OverlayPatcher struct {
+	lock       sync.Mutex
+	overlay    *overlay
+	key        interface{}
+	value      interface{}
+	original   interface{}
+	overridden bool
+	applied    bool
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (op *OverlayPatcher) Install() Patcher {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+
+	// Be idempotent
+	if op.applied {
+		return op
+	}
+
+	// Set the override, saving any existing override
+	op.original, op.overridden = op.overlay.set(op.key, op.value, true)
+	op.applied = true
+
+	return op
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (op *OverlayPatcher) Restore() Patcher {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+
+	// Be idempotent
+	if !op.applied {
+		return op
+	}
+
+	// Restore the previous override, if any
+	op.overlay.set(op.key, op.original, op.overridden)
+	op.original = nil
+	op.applied = false
+
+	return op
+}
+
+// Global implements GlobalPatcher.  An OverlayPatcher only affects a
+// single test, so it never touches process-global state.
+func (op *OverlayPatcher) Global() bool {
+	return false
+}
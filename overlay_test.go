@@ -0,0 +1,140 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverlayPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*GlobalPatcher)(nil), &OverlayPatcher{})
+}
+
+func TestNewVar(t *testing.T) {
+	v := NewVar("default")
+
+	assert.Equal(t, "default", v.value)
+}
+
+func TestVarGetDefault(t *testing.T) {
+	v := NewVar("default")
+
+	assert.Equal(t, "default", v.Get(nil)) //nolint:staticcheck
+	assert.Equal(t, "default", v.Get(context.Background()))
+	assert.Equal(t, "default", v.Get(OverlayContext(t)))
+}
+
+func TestVarOverride(t *testing.T) {
+	v := NewVar("default")
+	other := NewVar(0)
+	var ctx context.Context
+
+	t.Run("override", func(t *testing.T) {
+		ctx = v.Override(t, "overridden")
+
+		assert.Equal(t, "overridden", v.Get(ctx))
+		assert.Equal(t, 0, other.Get(ctx))
+		assert.Equal(t, "default", v.Get(context.Background()))
+		assert.Contains(t, overlays.tests, testing.TB(t))
+	})
+
+	assert.Equal(t, "default", v.Get(ctx))
+	assert.Empty(t, overlays.tests)
+}
+
+func TestVarOverrideParallel(t *testing.T) {
+	v := NewVar(-1)
+
+	for i := 0; i < 10; i++ {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			t.Parallel()
+			ctx := v.Override(t, i)
+
+			for j := 0; j < 100; j++ {
+				runtime.Gosched()
+				assert.Equal(t, i, v.Get(ctx))
+			}
+			assert.Equal(t, -1, v.Get(context.Background()))
+		})
+	}
+}
+
+func TestVarPatchNested(t *testing.T) {
+	v := NewVar("default")
+	ctx := OverlayContext(t)
+	p1 := v.Patch(t, "first")
+	p2 := v.Patch(t, "second")
+	pm := NewPatchMaster(p1, p2)
+
+	pm.Install()
+	assert.Equal(t, "second", v.Get(ctx))
+	p2.Restore()
+	assert.Equal(t, "first", v.Get(ctx))
+	p2.Install()
+	assert.Equal(t, "second", v.Get(ctx))
+	pm.Restore()
+
+	assert.Equal(t, "default", v.Get(ctx))
+	assert.False(t, pm.Global())
+}
+
+func TestWithOverlay(t *testing.T) {
+	type ctxKey struct{}
+	v := NewVar("default")
+	parent := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	ctx := WithOverlay(parent, t)
+	v.Override(t, "overridden")
+
+	assert.Equal(t, "overridden", v.Get(ctx))
+	assert.Equal(t, "value", ctx.Value(ctxKey{}))
+}
+
+func TestOverlayPatcherInstallIdempotent(t *testing.T) {
+	v := NewVar("default")
+	op := v.Patch(t, "overridden")
+	op.Install()
+	op.overlay.set(v, "other", true)
+
+	result := op.Install()
+
+	assert.Same(t, op, result)
+	assert.Equal(t, "other", v.Get(OverlayContext(t)))
+	op.Restore()
+}
+
+func TestOverlayPatcherRestoreIdempotent(t *testing.T) {
+	v := NewVar("default")
+	op := v.Patch(t, "overridden")
+	op.overlay.set(v, "other", true)
+
+	result := op.Restore()
+
+	assert.Same(t, op, result)
+	assert.Equal(t, "other", v.Get(OverlayContext(t)))
+}
+
+func TestOverlayPatcherConcurrent(t *testing.T) {
+	v := NewVar("default")
+
+	hammer(v.Patch(t, "overridden"))
+
+	assert.Equal(t, "default", v.Get(OverlayContext(t)))
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// PatchPoint describes a patch point: a variable, such as a function
+// variable initialized to os.ReadFile, that exists to be patched by
+// tests.  The patchergen command generates a list of the patch points
+// in a package and registers them, and Points lists the registered
+// patch points.
+type PatchPoint struct {
+	Name     string      // The name of the patch point
+	Type     string      // The type of the variable
+	Variable interface{} // A pointer to the variable
+}
+
+// registry is the registry of named patch points.
+type registry struct {
+	lock   sync.Mutex
+	points map[string]PatchPoint
+}
+
+// points is the global patch point registry.
+var points = &registry{
+	points: map[string]PatchPoint{},
+}
+
+// lookup looks up a patch point by name.
+func (r *registry) lookup(name string) (PatchPoint, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	point, ok := r.points[name]
+
+	return point, ok
+}
+
+// Register registers a patch point under the specified name, allowing
+// it to be patched with ByName.  The variable must be a pointer to the
+// variable to patch.  Names are global, so they should be qualified
+// with the package name, as in "storage.readFile".  Registering a
+// different variable under an existing name causes a panic;
+// re-registering the same variable is permitted.  It would typically
+// be called from an init function like so:
+//
+//	var readFile = os.ReadFile
+//
+//	func init() {
+//		patcher.Register("storage.readFile", &readFile)
+//	}
+func Register(name string, variable interface{}) {
+	varReflect := reflect.ValueOf(variable)
+	if !varReflect.IsValid() || varReflect.Kind() != reflect.Ptr || varReflect.IsNil() {
+		panic(fmt.Sprintf("cannot register patch point %q: not a pointer to a variable", name))
+	}
+
+	points.lock.Lock()
+	defer points.lock.Unlock()
+
+	if existing, ok := points.points[name]; ok {
+		if existing.Variable == variable {
+			return
+		}
+		panic(fmt.Sprintf("patch point %q already registered", name))
+	}
+
+	points.points[name] = PatchPoint{
+		Name:     name,
+		Type:     varReflect.Type().Elem().String(),
+		Variable: variable,
+	}
+}
+
+// ByName constructs a VariableSetter for the patch point registered
+// under the specified name, storing its desired new value.  As with
+// SetVar, it panics if the value cannot be assigned to the variable;
+// it also panics if no patch point is registered under the name.  It
+// allows patches to be driven by test tables or configuration files,
+// and could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer ByName("storage.readFile", func(filename string) ([]byte, error) {
+//			return []byte("hello"), nil
+//		}).Install().Restore()
+//
+//		err := DoSomething("some-filename")
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func ByName(name string, value interface{}) *VariableSetter {
+	point, ok := points.lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("no patch point %q registered", name))
+	}
+
+	return SetVar(point.Variable, value)
+}
+
+// Points returns a list of all registered patch points, sorted by
+// name.
+func Points() []PatchPoint {
+	points.lock.Lock()
+	defer points.lock.Unlock()
+
+	result := make([]PatchPoint, 0, len(points.points))
+	for _, point := range points.points {
+		result = append(result, point)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
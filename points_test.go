@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withRegistry(t *testing.T) {
+	t.Helper()
+
+	orig := points
+	points = &registry{points: map[string]PatchPoint{}}
+	t.Cleanup(func() { points = orig })
+}
+
+func TestRegister(t *testing.T) {
+	withRegistry(t)
+	variable := "unpatched"
+
+	Register("test.variable", &variable)
+
+	assert.Equal(t, map[string]PatchPoint{
+		"test.variable": {Name: "test.variable", Type: "string", Variable: &variable},
+	}, points.points)
+}
+
+func TestRegisterSameVariable(t *testing.T) {
+	withRegistry(t)
+	variable := "unpatched"
+	Register("test.variable", &variable)
+
+	Register("test.variable", &variable)
+
+	assert.Len(t, points.points, 1)
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	withRegistry(t)
+	variable1 := "unpatched"
+	variable2 := "unpatched"
+	Register("test.variable", &variable1)
+
+	assert.PanicsWithValue(t, `patch point "test.variable" already registered`, func() {
+		Register("test.variable", &variable2)
+	})
+	assert.Same(t, &variable1, points.points["test.variable"].Variable)
+}
+
+func TestRegisterNotPointer(t *testing.T) {
+	withRegistry(t)
+	var nilPtr *string
+
+	for _, variable := range []interface{}{"unpatched", nil, nilPtr} {
+		assert.PanicsWithValue(t, `cannot register patch point "test.variable": not a pointer to a variable`, func() {
+			Register("test.variable", variable)
+		})
+	}
+	assert.Empty(t, points.points)
+}
+
+func TestByName(t *testing.T) {
+	withRegistry(t)
+	variable := "unpatched"
+	Register("test.variable", &variable)
+
+	vs := ByName("test.variable", "patched")
+
+	assert.Equal(t, reflect.ValueOf(&variable).Elem(), vs.variable)
+	assert.Equal(t, "patched", vs.value.Interface())
+	vs.Install()
+	assert.Equal(t, "patched", variable)
+	vs.Restore()
+	assert.Equal(t, "unpatched", variable)
+}
+
+func TestByNameUnassignable(t *testing.T) {
+	withRegistry(t)
+	variable := "unpatched"
+	Register("test.variable", &variable)
+
+	assert.PanicsWithValue(t, "cannot assign int type to variable type string", func() {
+		ByName("test.variable", 12345)
+	})
+}
+
+func TestByNameUnregistered(t *testing.T) {
+	withRegistry(t)
+
+	assert.PanicsWithValue(t, `no patch point "test.variable" registered`, func() {
+		ByName("test.variable", "patched")
+	})
+}
+
+func TestPoints(t *testing.T) {
+	withRegistry(t)
+	variable := "unpatched"
+	readFile := os.ReadFile
+	Register("test.variable", &variable)
+	Register("test.readFile", &readFile)
+
+	result := Points()
+
+	assert.Equal(t, []PatchPoint{
+		{Name: "test.readFile", Type: "func(string) ([]uint8, error)", Variable: &readFile},
+		{Name: "test.variable", Type: "string", Variable: &variable},
+	}, result)
+}
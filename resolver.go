@@ -0,0 +1,441 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrBadRecord is the error used when a record passed to Resolver
+// cannot be parsed.
+var ErrBadRecord = errors.New("bad DNS record")
+
+// DNS record types and other protocol constants used by the
+// in-process DNS server.
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeTXT   = 16
+	dnsTypeAAAA  = 28
+	dnsTypeSRV   = 33
+
+	dnsClassINET = 1
+	dnsTTL       = 60
+	dnsMaxCNAME  = 8
+
+	dnsHeaderLen    = 12
+	dnsFlagResponse = 0x8000
+	dnsFlagAuth     = 0x0400
+	dnsFlagRecurse  = 0x0100
+	dnsFlagAvail    = 0x0080
+	dnsRCodeNXD     = 3
+)
+
+// dnsRecord describes a single resource record served by the
+// in-process DNS server.  The data is the encoded RDATA; for CNAME
+// records, the target is also stored so that it can be chased.
+type dnsRecord struct {
+	rtype  uint16
+	data   []byte
+	target string
+}
+
+// ResolverPatcher is a patcher that replaces net.DefaultResolver with
+// a pure-Go resolver that sends its queries to an in-process DNS
+// server answering from a static table.
+type ResolverPatcher struct {
+	lock     sync.Mutex
+	records  map[string][]dnsRecord
+	original *net.Resolver
+	applied  bool
+}
+
+// Resolver constructs a ResolverPatcher, storing the table of
+// records to serve.  The table maps host names to record values; a
+// value is either a bare IP address, which is served as an A or AAAA
+// record as appropriate, or a record type followed by its data:
+//
+//	"A 192.0.2.1"
+//	"AAAA 2001:db8::1"
+//	"CNAME target.example.com"
+//	"SRV <priority> <weight> <port> <target>"
+//	"TXT arbitrary text"
+//
+// SRV records must be keyed by the full service name, such as
+// "_http._tcp.example.com".  Names that are not in the table are
+// reported as nonexistent.  A record that cannot be parsed causes a
+// panic.  It could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer Resolver(map[string][]string{
+//			"db.example.com": {"192.0.2.1", "2001:db8::1"},
+//		}).Install().Restore()
+//
+//		err := DoSomething("db.example.com")
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func Resolver(records map[string][]string) *ResolverPatcher {
+	rp := &ResolverPatcher{
+		records: map[string][]dnsRecord{},
+	}
+
+	for name, values := range records {
+		if _, err := encodeName(name); err != nil {
+			panic(err)
+		}
+		key := canonicalName(name)
+		for _, value := range values {
+			rec, err := parseRecord(value)
+			if err != nil {
+				panic(fmt.Errorf("%s: %w", name, err))
+			}
+			rp.records[key] = append(rp.records[key], rec)
+		}
+	}
+
+	return rp
+}
+
+// canonicalName converts a host name to the form used as a key in
+// the records table.
+func canonicalName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+
+	return name
+}
+
+// encodeName encodes a domain name in DNS wire format, without
+// compression.
+func encodeName(name string) ([]byte, error) {
+	name = canonicalName(name)
+	if len(name) > 255 {
+		return nil, fmt.Errorf("%w: name %q too long", ErrBadRecord, name)
+	}
+
+	buf := []byte{}
+	if name != "." {
+		for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+			if label == "" || len(label) > 63 {
+				return nil, fmt.Errorf("%w: bad label in name %q", ErrBadRecord, name)
+			}
+			buf = append(buf, byte(len(label)))
+			buf = append(buf, label...)
+		}
+	}
+
+	return append(buf, 0), nil
+}
+
+// parseRecord parses a record value.
+func parseRecord(value string) (dnsRecord, error) {
+	// Bare IP addresses
+	if ip := net.ParseIP(value); ip != nil {
+		return ipRecord(ip), nil
+	}
+
+	rtype, data := value, ""
+	if i := strings.IndexByte(value, ' '); i >= 0 {
+		rtype, data = value[:i], strings.TrimSpace(value[i+1:])
+	}
+
+	switch strings.ToUpper(rtype) {
+	case "A", "AAAA":
+		ip := net.ParseIP(data)
+		if ip == nil || (strings.ToUpper(rtype) == "A") != (ip.To4() != nil) {
+			return dnsRecord{}, fmt.Errorf("%w: bad address in %q", ErrBadRecord, value)
+		}
+		return ipRecord(ip), nil
+
+	case "CNAME":
+		target, err := encodeName(data)
+		if err != nil {
+			return dnsRecord{}, err
+		}
+		return dnsRecord{rtype: dnsTypeCNAME, data: target, target: canonicalName(data)}, nil
+
+	case "SRV":
+		return parseSRV(value, data)
+
+	case "TXT":
+		return dnsRecord{rtype: dnsTypeTXT, data: encodeTXT(data)}, nil
+	}
+
+	return dnsRecord{}, fmt.Errorf("%w: unrecognized record %q", ErrBadRecord, value)
+}
+
+// ipRecord constructs an A or AAAA record for an IP address.
+func ipRecord(ip net.IP) dnsRecord {
+	if ip4 := ip.To4(); ip4 != nil {
+		return dnsRecord{rtype: dnsTypeA, data: []byte(ip4)}
+	}
+
+	return dnsRecord{rtype: dnsTypeAAAA, data: []byte(ip.To16())}
+}
+
+// parseSRV parses the data of an SRV record.
+func parseSRV(value, data string) (dnsRecord, error) {
+	fields := strings.Fields(data)
+	if len(fields) != 4 {
+		return dnsRecord{}, fmt.Errorf("%w: SRV record %q needs priority, weight, port, and target", ErrBadRecord, value)
+	}
+
+	buf := []byte{}
+	for _, field := range fields[:3] {
+		num, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return dnsRecord{}, fmt.Errorf("%w: bad number in SRV record %q", ErrBadRecord, value)
+		}
+		buf = appendUint16(buf, uint16(num))
+	}
+
+	target, err := encodeName(fields[3])
+	if err != nil {
+		return dnsRecord{}, err
+	}
+
+	return dnsRecord{rtype: dnsTypeSRV, data: append(buf, target...)}, nil
+}
+
+// encodeTXT encodes the data of a TXT record, splitting it into
+// character strings of at most 255 bytes.
+func encodeTXT(text string) []byte {
+	buf := []byte{}
+	for {
+		chunk := text
+		if len(chunk) > 255 {
+			chunk = chunk[:255]
+		}
+		buf = append(buf, byte(len(chunk)))
+		buf = append(buf, chunk...)
+		text = text[len(chunk):]
+
+		if text == "" {
+			return buf
+		}
+	}
+}
+
+// dial is the Dial function of the replacement resolver.  Each
+// connection is served by its own goroutine over an in-memory pipe.
+// As the pipe is not a net.PacketConn, the resolver uses the TCP
+// framing of DNS messages regardless of the requested network.
+func (rp *ResolverPatcher) dial(_ context.Context, _, _ string) (net.Conn, error) {
+	client, server := net.Pipe()
+	go rp.serve(server)
+
+	return client, nil
+}
+
+// serve answers DNS queries arriving on a connection until the
+// connection is closed or a malformed query is received.
+func (rp *ResolverPatcher) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		resp := rp.respond(query)
+		if resp == nil {
+			return
+		}
+		if _, err := conn.Write(append(appendUint16(nil, uint16(len(resp))), resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// parseQuestion parses the question section of a query, returning
+// the question in wire format, the canonical name, and the type and
+// class queried.  It returns a nil question if the query is
+// malformed.
+func parseQuestion(query []byte) ([]byte, string, uint16, uint16) {
+	if len(query) < dnsHeaderLen || binary.BigEndian.Uint16(query[4:]) != 1 {
+		return nil, "", 0, 0
+	}
+
+	labels := []string{}
+	off := dnsHeaderLen
+	for {
+		if off >= len(query) {
+			return nil, "", 0, 0
+		}
+		length := int(query[off])
+		off++
+		if length == 0 {
+			break
+		}
+		if length > 63 || off+length > len(query) {
+			return nil, "", 0, 0
+		}
+		labels = append(labels, string(query[off:off+length]))
+		off += length
+	}
+	if off+4 > len(query) {
+		return nil, "", 0, 0
+	}
+
+	return query[dnsHeaderLen : off+4], canonicalName(strings.Join(labels, ".")),
+		binary.BigEndian.Uint16(query[off:]), binary.BigEndian.Uint16(query[off+2:])
+}
+
+// respond constructs the response to a query.  It returns nil if the
+// query is malformed.
+func (rp *ResolverPatcher) respond(query []byte) []byte {
+	question, name, qtype, qclass := parseQuestion(query)
+	if question == nil {
+		return nil
+	}
+
+	// Select the answers
+	answers, count := []byte{}, 0
+	_, found := rp.records[name]
+	if qclass == dnsClassINET {
+		answers, count = rp.answer(answers, name, qtype, 0)
+	}
+
+	// Build the header
+	flags := uint16(dnsFlagResponse | dnsFlagAuth | dnsFlagAvail)
+	flags |= binary.BigEndian.Uint16(query[2:]) & dnsFlagRecurse
+	if !found {
+		flags |= dnsRCodeNXD
+	}
+	resp := append([]byte{}, query[:2]...)
+	resp = appendUint16(resp, flags)
+	resp = appendUint16(resp, 1)
+	resp = appendUint16(resp, uint16(count))
+	resp = appendUint16(resp, 0)
+	resp = appendUint16(resp, 0)
+
+	resp = append(resp, question...)
+	return append(resp, answers...)
+}
+
+// answer appends the answers for a name and type to a buffer,
+// chasing CNAME records if the name has no records of the requested
+// type.  It returns the updated buffer and the number of records
+// added.
+func (rp *ResolverPatcher) answer(buf []byte, name string, qtype uint16, depth int) ([]byte, int) {
+	count := 0
+	var cname *dnsRecord
+	for i, rec := range rp.records[name] {
+		switch rec.rtype {
+		case qtype:
+			buf = appendRR(buf, name, rec)
+			count++
+
+		case dnsTypeCNAME:
+			cname = &rp.records[name][i]
+		}
+	}
+
+	if count == 0 && cname != nil && depth < dnsMaxCNAME {
+		buf = appendRR(buf, name, *cname)
+		var chased int
+		buf, chased = rp.answer(buf, cname.target, qtype, depth+1)
+		count += chased + 1
+	}
+
+	return buf, count
+}
+
+// appendUint16 appends a big-endian 16-bit integer to a buffer.
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+// appendUint32 appends a big-endian 32-bit integer to a buffer.
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// appendRR appends a resource record to a buffer.
+func appendRR(buf []byte, name string, rec dnsRecord) []byte {
+	encoded, _ := encodeName(name) // names in the table were validated
+	buf = append(buf, encoded...)
+	buf = appendUint16(buf, rec.rtype)
+	buf = appendUint16(buf, dnsClassINET)
+	buf = appendUint32(buf, dnsTTL)
+	buf = appendUint16(buf, uint16(len(rec.data)))
+
+	return append(buf, rec.data...)
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (rp *ResolverPatcher) Install() Patcher {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	// Be idempotent
+	if rp.applied {
+		return rp
+	}
+
+	// Save the current resolver and set the new one
+	rp.original = net.DefaultResolver
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial:     rp.dial,
+	}
+	rp.applied = true
+
+	return rp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (rp *ResolverPatcher) Restore() Patcher {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	// Be idempotent
+	if !rp.applied {
+		return rp
+	}
+
+	// Restore the original resolver
+	net.DefaultResolver = rp.original
+	rp.applied = false
+
+	return rp
+}
+
+// Global implements GlobalPatcher.  A ResolverPatcher always touches
+// process-global state, since it replaces net.DefaultResolver.
+func (rp *ResolverPatcher) Global() bool {
+	return true
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*Patcher)(nil), &ResolverPatcher{})
+}
+
+func TestResolverBase(t *testing.T) {
+	result := Resolver(map[string][]string{
+		"Host.Example.Test": {"192.0.2.1", "AAAA 2001:db8::1"},
+	})
+
+	assert.Equal(t, map[string][]dnsRecord{
+		"host.example.test.": {
+			{rtype: dnsTypeA, data: []byte{192, 0, 2, 1}},
+			{rtype: dnsTypeAAAA, data: []byte(net.ParseIP("2001:db8::1"))},
+		},
+	}, result.records)
+	assert.Nil(t, result.original)
+	assert.False(t, result.applied)
+}
+
+func TestResolverBadName(t *testing.T) {
+	assert.Panics(t, func() {
+		Resolver(map[string][]string{
+			"bad..name": {"192.0.2.1"},
+		})
+	})
+}
+
+func TestResolverBadRecord(t *testing.T) {
+	assert.Panics(t, func() {
+		Resolver(map[string][]string{
+			"host.example.test": {"BOGUS"},
+		})
+	})
+}
+
+func TestParseRecord(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	tests := []struct {
+		name   string
+		value  string
+		result dnsRecord
+		err    bool
+	}{
+		{name: "bare v4", value: "192.0.2.1", result: dnsRecord{rtype: dnsTypeA, data: []byte{192, 0, 2, 1}}},
+		{name: "typed v4", value: "a 192.0.2.1", result: dnsRecord{rtype: dnsTypeA, data: []byte{192, 0, 2, 1}}},
+		{name: "bad A", value: "A 2001:db8::1", err: true},
+		{name: "bad AAAA", value: "AAAA 192.0.2.1", err: true},
+		{name: "bad address", value: "A bogus", err: true},
+		{
+			name:   "CNAME",
+			value:  "CNAME target.test",
+			result: dnsRecord{rtype: dnsTypeCNAME, data: []byte("\x06target\x04test\x00"), target: "target.test."},
+		},
+		{name: "bad CNAME", value: "CNAME bad..test", err: true},
+		{
+			name:   "SRV",
+			value:  "SRV 10 5 8080 target.test.",
+			result: dnsRecord{rtype: dnsTypeSRV, data: []byte("\x00\x0a\x00\x05\x1f\x90\x06target\x04test\x00")},
+		},
+		{name: "SRV short", value: "SRV 10 5 target.test", err: true},
+		{name: "SRV bad number", value: "SRV 10 5 99999 target.test", err: true},
+		{name: "SRV bad target", value: "SRV 10 5 80 " + long, err: true},
+		{name: "TXT", value: "TXT hello world", result: dnsRecord{rtype: dnsTypeTXT, data: []byte("\x0bhello world")}},
+		{
+			name:   "TXT long",
+			value:  "TXT " + long,
+			result: dnsRecord{rtype: dnsTypeTXT, data: []byte("\xff" + long[:255] + "\x2d" + long[255:])},
+		},
+		{name: "unknown", value: "MX 10 mail.test", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := parseRecord(test.value)
+
+			if test.err {
+				assert.True(t, errors.Is(err, ErrBadRecord))
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.result, result)
+			}
+		})
+	}
+}
+
+func TestResolverPatcherLookups(t *testing.T) {
+	original := net.DefaultResolver
+	rp := Resolver(map[string][]string{
+		"host.example.test":           {"192.0.2.1", "2001:db8::1"},
+		"alias.example.test":          {"CNAME host.example.test"},
+		"empty.example.test":          {"TXT nothing here"},
+		"_http._tcp.example.test":     {"SRV 10 5 8080 host.example.test"},
+		"loop.example.test":           {"CNAME loop.example.test"},
+		"partial-alias.example.test.": {"CNAME missing.example.test"},
+	})
+	ctx := context.Background()
+
+	result := rp.Install()
+	defer rp.Restore()
+
+	assert.Same(t, rp, result)
+	assert.True(t, rp.applied)
+	assert.Same(t, original, rp.original)
+	assert.NotSame(t, original, net.DefaultResolver)
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, "host.example.test")
+	require.NoError(t, err)
+	sort.Strings(addrs)
+	assert.Equal(t, []string{"192.0.2.1", "2001:db8::1"}, addrs)
+
+	addrs, err = net.DefaultResolver.LookupHost(ctx, "alias.example.test")
+	require.NoError(t, err)
+	sort.Strings(addrs)
+	assert.Equal(t, []string{"192.0.2.1", "2001:db8::1"}, addrs)
+
+	cname, err := net.DefaultResolver.LookupCNAME(ctx, "alias.example.test")
+	require.NoError(t, err)
+	assert.Equal(t, "host.example.test.", cname)
+
+	txt, err := net.DefaultResolver.LookupTXT(ctx, "empty.example.test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nothing here"}, txt)
+
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "http", "tcp", "example.test")
+	require.NoError(t, err)
+	assert.Equal(t, []*net.SRV{{Target: "host.example.test.", Port: 8080, Priority: 10, Weight: 5}}, srvs)
+
+	_, err = net.DefaultResolver.LookupHost(ctx, "missing.example.test")
+	dnsErr := &net.DNSError{}
+	require.True(t, errors.As(err, &dnsErr))
+	assert.True(t, dnsErr.IsNotFound)
+
+	_, err = net.DefaultResolver.LookupHost(ctx, "empty.example.test")
+	assert.Error(t, err)
+
+	_, err = net.DefaultResolver.LookupHost(ctx, "loop.example.test")
+	assert.Error(t, err)
+}
+
+func TestResolverPatcherRespondMalformed(t *testing.T) {
+	rp := Resolver(nil)
+	header := []byte{0, 1, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+
+	assert.Nil(t, rp.respond([]byte{0, 1}))
+	assert.Nil(t, rp.respond(append(append([]byte{}, header...), 3, 'f', 'o')))
+	assert.Nil(t, rp.respond(append(append([]byte{}, header...), 64)))
+	assert.Nil(t, rp.respond(append(append([]byte{}, header...), 3, 'f', 'o', 'o', 0, 0, 1)))
+	assert.Nil(t, rp.respond(header))
+}
+
+func TestResolverPatcherRespondOtherClass(t *testing.T) {
+	rp := Resolver(map[string][]string{
+		"foo": {"192.0.2.1"},
+	})
+	query := []byte{0, 1, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 3, 'f', 'o', 'o', 0, 0, 1, 0, 3}
+
+	result := rp.respond(query)
+
+	assert.Equal(t, []byte{
+		0, 1, 0x85, 0x80, 0, 1, 0, 0, 0, 0, 0, 0,
+		3, 'f', 'o', 'o', 0, 0, 1, 0, 3,
+	}, result)
+}
+
+func TestResolverPatcherServeMalformed(t *testing.T) {
+	rp := Resolver(nil)
+	conn, err := rp.dial(context.Background(), "udp", "127.0.0.1:53")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte{0, 2, 0, 1})
+	require.NoError(t, err)
+	_, err = conn.Read(make([]byte, 2))
+
+	assert.Error(t, err)
+}
+
+func TestResolverPatcherInstallIdempotent(t *testing.T) {
+	original := net.DefaultResolver
+	rp := Resolver(nil)
+	rp.applied = true
+
+	result := rp.Install()
+
+	assert.Same(t, rp, result)
+	assert.Same(t, original, net.DefaultResolver)
+	assert.True(t, rp.applied)
+}
+
+func TestResolverPatcherRestore(t *testing.T) {
+	original := net.DefaultResolver
+	rp := Resolver(nil)
+	rp.Install()
+
+	result := rp.Restore()
+
+	assert.Same(t, rp, result)
+	assert.Same(t, original, net.DefaultResolver)
+	assert.False(t, rp.applied)
+}
+
+func TestResolverPatcherRestoreIdempotent(t *testing.T) {
+	original := net.DefaultResolver
+	rp := Resolver(nil)
+
+	result := rp.Restore()
+
+	assert.Same(t, rp, result)
+	assert.Same(t, original, net.DefaultResolver)
+	assert.False(t, rp.applied)
+}
+
+func TestResolverPatcherConcurrent(t *testing.T) {
+	original := net.DefaultResolver
+
+	hammer(Resolver(nil))
+
+	assert.Same(t, original, net.DefaultResolver)
+}
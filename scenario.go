@@ -0,0 +1,356 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrBadScenario is the error returned when a scenario file is
+// invalid.  The error message includes the file name and the line and
+// column of the problem.
+var ErrBadScenario = errors.New("invalid scenario")
+
+// errorType is the reflected type of error.
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ScenarioOption is an option that may be passed to LoadScenario and
+// ParseScenario.
+type ScenarioOption func(sl *scenarioLoader)
+
+// ScenarioLog is a ScenarioOption that sets the destination for log
+// output captured by a scenario with "log: true".  By default,
+// captured log output is discarded.
+func ScenarioLog(output io.Writer) ScenarioOption {
+	return func(sl *scenarioLoader) {
+		sl.log = output
+	}
+}
+
+// scenarioLoader contains the state for loading a scenario.
+type scenarioLoader struct {
+	name string
+	log  io.Writer
+	pm   *PatchMaster
+}
+
+// LoadScenario loads a scenario file, in YAML or JSON, and returns a
+// PatchMaster containing the patches it describes.  A scenario file
+// is a mapping with the following optional sections:
+//
+//	# Environment variables to set; null unsets the variable
+//	env:
+//	  CONFIG: /etc/app.yaml
+//	  DEBUG: null
+//	# Capture log output; see ScenarioLog
+//	log: true
+//	# Working directory
+//	dir: testdata/work
+//	# Registered patch points and their values
+//	points:
+//	  storage.maxRetries: 3
+//	# Return sequences for registered function patch points; the
+//	# last entry is repeated once the sequence is exhausted
+//	stubs:
+//	  storage.readFile:
+//	    - ["hello", null]
+//	    - [null, "file not found"]
+//
+// Patch points must have been registered with Register.  Values are
+// decoded into the type of the patch point; byte slices are given as
+// strings, and values of type error are given as a string message or
+// null.  Each stub entry lists the function's return values, although
+// a bare value may be given for a function returning a single value.
+// The stubs start over from the first entry each time the patches are
+// installed.  It could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		pm, err := LoadScenario("testdata/missing-file.yaml")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		defer pm.Install().Restore()
+//
+//		err = DoSomething("some-filename")
+//
+//		if err == nil {
+//			t.Fail("nil error!")
+//		}
+//	}
+func LoadScenario(path string, opts ...ScenarioOption) (*PatchMaster, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseScenario(path, data, opts...)
+}
+
+// ParseScenario is like LoadScenario, but parses the scenario from
+// data.  The name is used in error messages.
+func ParseScenario(name string, data []byte, opts ...ScenarioOption) (*PatchMaster, error) {
+	sl := &scenarioLoader{
+		name: name,
+		log:  io.Discard,
+		pm:   NewPatchMaster(),
+	}
+	for _, opt := range opts {
+		opt(sl)
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrBadScenario, name, err)
+	}
+	if len(doc.Content) == 0 {
+		return sl.pm, nil
+	}
+
+	if err := sl.mapping(doc.Content[0], sl.section); err != nil {
+		return nil, err
+	}
+
+	return sl.pm, nil
+}
+
+// errorf constructs an error pointing at the specified node.
+func (sl *scenarioLoader) errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s:%d:%d: %s", ErrBadScenario, sl.name, node.Line, node.Column, fmt.Sprintf(format, args...))
+}
+
+// resolve resolves alias nodes.
+func resolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	return node
+}
+
+// isNull tests whether a node is null.
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null"
+}
+
+// mapping calls a function for each key and value of a mapping node,
+// rejecting duplicate keys.
+func (sl *scenarioLoader) mapping(node *yaml.Node, fn func(key, value *yaml.Node) error) error {
+	node = resolve(node)
+	if node.Kind != yaml.MappingNode {
+		return sl.errorf(node, "expected a mapping")
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := resolve(node.Content[i]), resolve(node.Content[i+1])
+		if key.Kind != yaml.ScalarNode {
+			return sl.errorf(key, "expected a string key")
+		}
+		if seen[key.Value] {
+			return sl.errorf(key, "duplicate key %q", key.Value)
+		}
+		seen[key.Value] = true
+
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// section processes a top-level section of the scenario.
+func (sl *scenarioLoader) section(key, value *yaml.Node) error {
+	switch key.Value {
+	case "env":
+		return sl.mapping(value, sl.env)
+
+	case "log":
+		capture := false
+		if err := value.Decode(&capture); err != nil {
+			return sl.errorf(value, "expected a boolean")
+		}
+		if capture {
+			sl.pm.Add(Log(sl.log))
+		}
+
+	case "dir":
+		if value.Kind != yaml.ScalarNode || isNull(value) {
+			return sl.errorf(value, "expected a directory name")
+		}
+		sl.pm.Add(Chdir(value.Value))
+
+	case "points":
+		return sl.mapping(value, sl.point)
+
+	case "stubs":
+		return sl.mapping(value, sl.stub)
+
+	default:
+		return sl.errorf(key, "unknown section %q", key.Value)
+	}
+
+	return nil
+}
+
+// env processes an environment variable.
+func (sl *scenarioLoader) env(key, value *yaml.Node) error {
+	switch {
+	case isNull(value):
+		sl.pm.Add(UnsetEnv(key.Value))
+	case value.Kind == yaml.ScalarNode:
+		sl.pm.Add(SetEnv(key.Value, value.Value))
+	default:
+		return sl.errorf(value, "expected a string or null for environment variable %q", key.Value)
+	}
+
+	return nil
+}
+
+// lookup looks up a registered patch point.
+func (sl *scenarioLoader) lookup(key *yaml.Node) (PatchPoint, reflect.Value, error) {
+	point, ok := points.lookup(key.Value)
+	if !ok {
+		return PatchPoint{}, reflect.Value{}, sl.errorf(key, "unknown patch point %q", key.Value)
+	}
+
+	return point, reflect.ValueOf(point.Variable).Elem(), nil
+}
+
+// decode decodes a node into a value of the specified type.
+func (sl *scenarioLoader) decode(node *yaml.Node, typ reflect.Type) (reflect.Value, error) {
+	value := reflect.New(typ).Elem()
+
+	switch {
+	case typ == errorType:
+		// Errors are given by their messages
+		if isNull(node) {
+			return value, nil
+		} else if node.Kind == yaml.ScalarNode {
+			value.Set(reflect.ValueOf(errors.New(node.Value)))
+			return value, nil
+		}
+
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		// Byte slices are given as strings
+		if isNull(node) {
+			return value, nil
+		} else if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!str" {
+			value.Set(reflect.ValueOf([]byte(node.Value)).Convert(typ))
+			return value, nil
+		}
+
+	case typ.Kind() == reflect.Func, typ.Kind() == reflect.Chan, typ.Kind() == reflect.UnsafePointer,
+		typ.Kind() == reflect.Interface && typ.NumMethod() > 0:
+		// Values of these types cannot be decoded
+
+	default:
+		if err := node.Decode(value.Addr().Interface()); err == nil {
+			return value, nil
+		}
+	}
+
+	return reflect.Value{}, sl.errorf(node, "cannot decode value of type %s", typ)
+}
+
+// point processes a patch point value.
+func (sl *scenarioLoader) point(key, value *yaml.Node) error {
+	_, variable, err := sl.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	val, err := sl.decode(value, variable.Type())
+	if err != nil {
+		return err
+	}
+
+	sl.pm.Add(setVar(variable, val))
+
+	return nil
+}
+
+// stub processes a patch point return sequence.
+func (sl *scenarioLoader) stub(key, value *yaml.Node) error {
+	_, variable, err := sl.lookup(key)
+	if err != nil {
+		return err
+	}
+	typ := variable.Type()
+	if typ.Kind() != reflect.Func {
+		return sl.errorf(key, "patch point %q is not a function", key.Value)
+	}
+	if value.Kind != yaml.SequenceNode || len(value.Content) == 0 {
+		return sl.errorf(value, "expected a sequence of return values")
+	}
+
+	// Decode the return values
+	sequence := make([][]reflect.Value, 0, len(value.Content))
+	for _, entry := range value.Content {
+		entry = resolve(entry)
+		nodes := []*yaml.Node{entry}
+		if entry.Kind == yaml.SequenceNode || typ.NumOut() != 1 {
+			if entry.Kind != yaml.SequenceNode {
+				return sl.errorf(entry, "expected a sequence of %d return values", typ.NumOut())
+			}
+			nodes = entry.Content
+		}
+		if len(nodes) != typ.NumOut() {
+			return sl.errorf(entry, "expected %d return values, got %d", typ.NumOut(), len(nodes))
+		}
+
+		results := make([]reflect.Value, len(nodes))
+		for i, node := range nodes {
+			if results[i], err = sl.decode(resolve(node), typ.Out(i)); err != nil {
+				return err
+			}
+		}
+		sequence = append(sequence, results)
+	}
+
+	// Construct a new stub each time the patch is installed, so
+	// that the sequence starts over
+	sl.pm.Add(setVarFunc(variable, func() reflect.Value {
+		return sequenceStub(typ, sequence)
+	}))
+
+	return nil
+}
+
+// sequenceStub constructs a function of the specified type that
+// returns each of a sequence of return values in turn, repeating the
+// last once the sequence is exhausted.
+func sequenceStub(typ reflect.Type, sequence [][]reflect.Value) reflect.Value {
+	lock := &sync.Mutex{}
+	call := 0
+
+	return reflect.MakeFunc(typ, func([]reflect.Value) []reflect.Value {
+		lock.Lock()
+		defer lock.Unlock()
+
+		results := sequence[call]
+		if call < len(sequence)-1 {
+			call++
+		}
+
+		return results
+	})
+}
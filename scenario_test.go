@@ -0,0 +1,268 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scenarioPoints struct {
+	retries  int
+	timeout  time.Duration
+	names    []string
+	err      error
+	readFile func(string) ([]byte, error)
+	getpid   func() int
+	reader   io.Reader
+}
+
+func registerScenarioPoints(t *testing.T) *scenarioPoints {
+	t.Helper()
+
+	withRegistry(t)
+	sp := &scenarioPoints{
+		retries:  1,
+		timeout:  time.Second,
+		err:      assert.AnError,
+		readFile: os.ReadFile,
+		getpid:   os.Getpid,
+	}
+	Register("test.retries", &sp.retries)
+	Register("test.timeout", &sp.timeout)
+	Register("test.names", &sp.names)
+	Register("test.err", &sp.err)
+	Register("test.readFile", &sp.readFile)
+	Register("test.getpid", &sp.getpid)
+	Register("test.reader", &sp.reader)
+
+	return sp
+}
+
+func TestParseScenario(t *testing.T) {
+	sp := registerScenarioPoints(t)
+	dir := t.TempDir()
+	defer NewPatchMaster(
+		SetEnv("PATCHER_SCENARIO_SET", "original"),
+		SetEnv("PATCHER_SCENARIO_UNSET", "original"),
+	).Install().Restore()
+	logStream := &bytes.Buffer{}
+	src := `
+env:
+  PATCHER_SCENARIO_SET: value
+  PATCHER_SCENARIO_UNSET: null
+log: true
+dir: ` + dir + `
+points:
+  test.retries: 5
+  test.timeout: 10ms
+  test.names: [a, b]
+  test.err: null
+stubs:
+  test.readFile:
+    - ["hello", null]
+    - [null, "file not found"]
+  test.getpid: [42]
+`
+
+	pm, err := ParseScenario("scenario.yaml", []byte(src), ScenarioLog(logStream))
+	require.NoError(t, err)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	pm.Install()
+	func() {
+		defer pm.Restore()
+
+		assert.Equal(t, "value", os.Getenv("PATCHER_SCENARIO_SET"))
+		_, ok := os.LookupEnv("PATCHER_SCENARIO_UNSET")
+		assert.False(t, ok)
+		log.Print("logged")
+		assert.Contains(t, logStream.String(), "logged")
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+		assert.Equal(t, dir, wd)
+		assert.Equal(t, 5, sp.retries)
+		assert.Equal(t, 10*time.Millisecond, sp.timeout)
+		assert.Equal(t, []string{"a", "b"}, sp.names)
+		assert.NoError(t, sp.err)
+		data, err := sp.readFile("file")
+		assert.Equal(t, []byte("hello"), data)
+		assert.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			data, err = sp.readFile("file")
+			assert.Nil(t, data)
+			assert.EqualError(t, err, "file not found")
+		}
+		assert.Equal(t, 42, sp.getpid())
+	}()
+
+	assert.Equal(t, "original", os.Getenv("PATCHER_SCENARIO_SET"))
+	assert.Equal(t, "original", os.Getenv("PATCHER_SCENARIO_UNSET"))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, cwd, wd)
+	assert.Equal(t, 1, sp.retries)
+	assert.Equal(t, time.Second, sp.timeout)
+	assert.Nil(t, sp.names)
+	assert.Same(t, assert.AnError, sp.err)
+	assert.Equal(t, os.Getpid(), sp.getpid())
+}
+
+func TestParseScenarioJSON(t *testing.T) {
+	sp := registerScenarioPoints(t)
+	src := `{
+  "points": {"test.retries": 3},
+  "stubs": {"test.readFile": [["data", null]]}
+}`
+
+	pm, err := ParseScenario("scenario.json", []byte(src))
+	require.NoError(t, err)
+
+	defer pm.Install().Restore()
+	assert.Equal(t, 3, sp.retries)
+	data, err := sp.readFile("file")
+	assert.Equal(t, []byte("data"), data)
+	assert.NoError(t, err)
+}
+
+func TestParseScenarioReinstall(t *testing.T) {
+	sp := registerScenarioPoints(t)
+	src := `stubs:
+  test.readFile:
+    - ["first", null]
+    - ["second", null]
+`
+
+	pm, err := ParseScenario("scenario.yaml", []byte(src))
+	require.NoError(t, err)
+
+	pm.Install()
+	data, _ := sp.readFile("file")
+	assert.Equal(t, []byte("first"), data)
+	pm.Restore()
+	pm.Install()
+	defer pm.Restore()
+	data, _ = sp.readFile("file")
+	assert.Equal(t, []byte("first"), data)
+	data, _ = sp.readFile("file")
+	assert.Equal(t, []byte("second"), data)
+}
+
+func TestParseScenarioLogDisabled(t *testing.T) {
+	pm, err := ParseScenario("scenario.yaml", []byte("log: false\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, NewPatchMaster(), pm)
+}
+
+func TestParseScenarioEmpty(t *testing.T) {
+	pm, err := ParseScenario("scenario.yaml", []byte{})
+
+	require.NoError(t, err)
+	assert.Equal(t, NewPatchMaster(), pm)
+}
+
+func TestParseScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{name: "syntax", src: "env: [\n", err: "scenario.yaml: yaml: line 1: did not find expected node content"},
+		{name: "not mapping", src: "- env\n", err: "scenario.yaml:1:1: expected a mapping"},
+		{name: "bad key", src: "[a]: b\n", err: "scenario.yaml:1:1: expected a string key"},
+		{name: "duplicate key", src: "log: true\nlog: false\n", err: `scenario.yaml:2:1: duplicate key "log"`},
+		{name: "unknown section", src: "bogus: 1\n", err: `scenario.yaml:1:1: unknown section "bogus"`},
+		{name: "bad env", src: "env:\n  FOO: [a]\n", err: `scenario.yaml:2:8: expected a string or null for environment variable "FOO"`},
+		{name: "bad log", src: "log: maybe\n", err: "scenario.yaml:1:6: expected a boolean"},
+		{name: "bad dir", src: "dir: null\n", err: "scenario.yaml:1:6: expected a directory name"},
+		{name: "unknown point", src: "points:\n  test.bogus: 1\n", err: `scenario.yaml:2:3: unknown patch point "test.bogus"`},
+		{name: "bad point value", src: "points:\n  test.retries: many\n", err: "scenario.yaml:2:17: cannot decode value of type int"},
+		{name: "bad error value", src: "points:\n  test.err: [a]\n", err: "scenario.yaml:2:13: cannot decode value of type error"},
+		{name: "function value", src: "points:\n  test.getpid: 1\n", err: "scenario.yaml:2:16: cannot decode value of type func() int"},
+		{name: "interface value", src: "points:\n  test.reader: a\n", err: "scenario.yaml:2:16: cannot decode value of type io.Reader"},
+		{name: "unknown stub", src: "stubs:\n  test.bogus: [1]\n", err: `scenario.yaml:2:3: unknown patch point "test.bogus"`},
+		{name: "stub not function", src: "stubs:\n  test.retries: [1]\n", err: `scenario.yaml:2:3: patch point "test.retries" is not a function`},
+		{name: "stub not sequence", src: "stubs:\n  test.getpid: 1\n", err: "scenario.yaml:2:16: expected a sequence of return values"},
+		{name: "stub empty", src: "stubs:\n  test.getpid: []\n", err: "scenario.yaml:2:16: expected a sequence of return values"},
+		{name: "stub bare", src: "stubs:\n  test.readFile:\n    - hello\n", err: "scenario.yaml:3:7: expected a sequence of 2 return values"},
+		{name: "stub count", src: "stubs:\n  test.readFile:\n    - [hello]\n", err: "scenario.yaml:3:7: expected 2 return values, got 1"},
+		{name: "bad bytes", src: "stubs:\n  test.readFile:\n    - [1, null]\n", err: "scenario.yaml:3:8: cannot decode value of type []uint8"},
+		{name: "stub value", src: "stubs:\n  test.getpid:\n    - [1]\n    - x\n", err: "scenario.yaml:4:7: cannot decode value of type int"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registerScenarioPoints(t)
+
+			pm, err := ParseScenario("scenario.yaml", []byte(test.src))
+
+			assert.ErrorIs(t, err, ErrBadScenario)
+			assert.EqualError(t, err, "invalid scenario: "+test.err)
+			assert.Nil(t, pm)
+		})
+	}
+}
+
+func TestParseScenarioAlias(t *testing.T) {
+	sp := registerScenarioPoints(t)
+	src := "common: &count 7\npoints:\n  test.retries: *count\n"
+
+	_, err := ParseScenario("scenario.yaml", []byte(src))
+
+	assert.EqualError(t, err, `invalid scenario: scenario.yaml:1:1: unknown section "common"`)
+
+	src = "points: &points\n  test.retries: 7\nstubs:\n  test.getpid: [&pid 9, *pid]\n"
+	pm, err := ParseScenario("scenario.yaml", []byte(src))
+	require.NoError(t, err)
+
+	defer pm.Install().Restore()
+	assert.Equal(t, 7, sp.retries)
+	assert.Equal(t, 9, sp.getpid())
+	assert.Equal(t, 9, sp.getpid())
+}
+
+func TestLoadScenario(t *testing.T) {
+	sp := registerScenarioPoints(t)
+	defer SetVar(&readFile, func(name string) ([]byte, error) {
+		assert.Equal(t, "scenario.yaml", name)
+		return []byte("points:\n  test.retries: 2\n"), nil
+	}).Install().Restore()
+
+	pm, err := LoadScenario("scenario.yaml")
+	require.NoError(t, err)
+
+	defer pm.Install().Restore()
+	assert.Equal(t, 2, sp.retries)
+}
+
+func TestLoadScenarioReadFails(t *testing.T) {
+	defer SetVar(&readFile, func(name string) ([]byte, error) {
+		return nil, assert.AnError
+	}).Install().Restore()
+
+	pm, err := LoadScenario("scenario.yaml")
+
+	assert.Same(t, assert.AnError, err)
+	assert.Nil(t, pm)
+}
@@ -0,0 +1,12 @@
+# Add support for the nested module containing the patcherlint,
+# patchergen, and rewrite packages and the commands built on them;
+# these live in their own module so that consumers of the library do
+# not inherit their dependencies
+TOOLS_MOD = tools
+TEST_TARG += lint-tools test-tools
+
+lint-tools: $(GOLANGCI_LINT) $(LINT_CONF) ## Lint-check the tools module; may fix some lint issues
+	cd $(TOOLS_MOD) && $(abspath $(GOLANGCI_LINT)) run -c $(abspath $(LINT_CONF)) $(FIX_ARG) $(LINT_ARGS) ./...
+
+test-tools: ## Run the tools module tests
+	cd $(TOOLS_MOD) && $(GO) test $(MOD_ARG) $(TEST_ARGS) ./...
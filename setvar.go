@@ -17,13 +17,19 @@ package patcher
 import (
 	"fmt"
 	"reflect"
+	"sync"
 )
 
 // VariableSetter is a patcher that, given a pointer to a variable and
 // the desired patch value, will set that variable to that value.
 type VariableSetter struct {
+	lock     sync.Mutex
 	variable reflect.Value
 	value    reflect.Value
+	provider func() reflect.Value
+	reporter TamperReporter
+	expected reflect.Value
+	current  reflect.Value
 	original reflect.Value
 	applied  bool
 }
@@ -48,35 +54,155 @@ func SetVar(variable, value interface{}) *VariableSetter {
 	if varReflect.Type().Kind() != reflect.Ptr {
 		panic("cannot set variable passed to SetVar!")
 	}
-	v := varReflect.Elem()
 
-	// Convert the desired value and check that it can be assigned
-	// to the variable
-	val := reflect.ValueOf(value)
-	if !val.Type().AssignableTo(v.Type()) {
-		panic(fmt.Sprintf("cannot assign %s type to variable type %s", val.Type(), v.Type()))
+	return setVar(varReflect.Elem(), reflect.ValueOf(value))
+}
+
+// setVar constructs a VariableSetter for a variable, checking that the
+// value can be assigned to it.  A value of interface type may be used
+// to set an interface variable to nil.
+func setVar(variable, value reflect.Value) *VariableSetter {
+	if !value.Type().AssignableTo(variable.Type()) {
+		panic(fmt.Sprintf("cannot assign %s type to variable type %s", value.Type(), variable.Type()))
+	}
+
+	return &VariableSetter{
+		variable: variable,
+		value:    value,
+	}
+}
+
+// SetVarFunc constructs a VariableSetter, storing the variable and a
+// provider function that computes its desired new value.  The
+// provider is called each time the patch is installed, just before
+// the variable is set, so it may use resources that only exist once
+// earlier patches in a PatchMaster have been installed, or the
+// current value of the variable itself.  The computed value is
+// available from the Value method.  It could be used in a test
+// function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		server := HTTPServer(handler)
+//		defer NewPatchMaster(
+//			server,
+//			SetVarFunc(&baseURL, server.URL),
+//		).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func SetVarFunc[T any](variable *T, provider func() T) *VariableSetter {
+	if variable == nil {
+		panic("cannot set variable passed to SetVarFunc!")
+	}
+	if provider == nil {
+		panic("cannot use nil provider passed to SetVarFunc!")
 	}
 
+	return setVarFunc(reflect.ValueOf(variable).Elem(), func() reflect.Value {
+		// Going through a pointer preserves nil interface values
+		value := provider()
+		return reflect.ValueOf(&value).Elem()
+	})
+}
+
+// setVarFunc constructs a VariableSetter for a variable and a provider
+// function computing its value each time the patch is installed.  The
+// provider must return a value assignable to the variable.
+func setVarFunc(variable reflect.Value, provider func() reflect.Value) *VariableSetter {
 	return &VariableSetter{
-		variable: v,
-		value:    val,
+		variable: variable,
+		provider: provider,
+	}
+}
+
+// Value returns the value the variable is set to while the patch is
+// installed.  For a VariableSetter constructed with SetVarFunc, this
+// is the value computed by the most recent Install, or nil if the
+// patch has never been installed.
+func (vs *VariableSetter) Value() interface{} {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
+	if !vs.value.IsValid() {
+		return nil
+	}
+
+	return vs.value.Interface()
+}
+
+// DetectTampering sets a TamperReporter that is called if, when the
+// patch is restored, the variable no longer holds the value set by
+// the patch, either because it was set to another value, even an
+// equal one, or because the value was changed in place.  The value
+// and a deep copy of it are saved for the comparison when the patch
+// is installed, or immediately if the patch is already installed.
+// Passing nil disables the check.  It returns the VariableSetter, so
+// it could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer SetVar(&config, testConfig).DetectTampering(TamperTB(t)).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func (vs *VariableSetter) DetectTampering(reporter TamperReporter) *VariableSetter {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
+	vs.reporter = reporter
+
+	// If the patch is already installed, the variable holds the
+	// value to compare against
+	if vs.applied && reporter != nil && !vs.expected.IsValid() {
+		vs.saveExpected()
 	}
+
+	return vs
+}
+
+// saveExpected saves the value of the variable, to detect whether it
+// is replaced, and a deep copy of it, to detect whether it is changed
+// in place.  It must be called with the lock held.
+func (vs *VariableSetter) saveExpected() {
+	vs.current = reflect.New(vs.variable.Type()).Elem()
+	vs.current.Set(vs.variable)
+	vs.expected = deepCopy(vs.variable)
 }
 
 // Install installs the patch.  It should store metadata sufficient to
 // allow Restore to restore the original data.  This method must be
 // idempotent.
 func (vs *VariableSetter) Install() Patcher {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
 	// Be idempotent
 	if vs.applied {
 		return vs
 	}
 
-	// Save the current value of the variable
-	vs.original = reflect.ValueOf(vs.variable.Interface())
+	// Save the current value of the variable; copying it into a
+	// new value preserves nil interface values
+	vs.original = reflect.New(vs.variable.Type()).Elem()
+	vs.original.Set(vs.variable)
+
+	// Compute the value if there's a provider
+	if vs.provider != nil {
+		vs.value = vs.provider()
+	}
 
 	// Set the new value and store that it's applied
 	vs.variable.Set(vs.value)
+	if vs.reporter != nil {
+		vs.saveExpected()
+	}
 	vs.applied = true
 
 	return vs
@@ -85,15 +211,43 @@ func (vs *VariableSetter) Install() Patcher {
 // Restore uses the metadata stored by Install to restore the patch to
 // its original value.  This method must be idempotent.
 func (vs *VariableSetter) Restore() Patcher {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
 	// Be idempotent
 	if !vs.applied {
 		return vs
 	}
 
+	// Check whether the variable was changed
+	msg := ""
+	if vs.reporter != nil && vs.expected.IsValid() &&
+		(!sameValue(vs.current, vs.variable) || !equalValues(vs.expected, vs.variable, map[visit]bool{})) {
+		msg = tamperDiff(
+			fmt.Sprintf("variable of type %s", vs.variable.Type()),
+			tamperDump(vs.expected),
+			tamperDump(vs.variable),
+		)
+	}
+
 	// Restore the variable's original value and clear the applied
 	// flag
 	vs.variable.Set(vs.original)
+	vs.expected = reflect.Value{}
+	vs.current = reflect.Value{}
 	vs.applied = false
 
+	// Report any change
+	if msg != "" {
+		vs.reporter(msg)
+	}
+
 	return vs
 }
+
+// Global implements GlobalPatcher.  A VariableSetter is assumed to
+// touch process-global state, since the variable is usually a package
+// variable.
+func (vs *VariableSetter) Global() bool {
+	return true
+}
@@ -15,6 +15,8 @@
 package patcher
 
 import (
+	"fmt"
+	"math"
 	"reflect"
 	"testing"
 
@@ -78,6 +80,95 @@ func TestSetVarIncompatibleFunc(t *testing.T) {
 	})
 }
 
+func TestSetVarFuncBase(t *testing.T) {
+	variable := "unpatched"
+
+	result := SetVarFunc(&variable, func() string { return "patched" })
+
+	assert.Equal(t, reflect.ValueOf(&variable).Elem(), result.variable)
+	assert.False(t, result.value.IsValid())
+	assert.NotNil(t, result.provider)
+	assert.False(t, result.applied)
+}
+
+func TestSetVarFuncNilVariable(t *testing.T) {
+	assert.PanicsWithValue(t, "cannot set variable passed to SetVarFunc!", func() {
+		SetVarFunc(nil, func() string { return "patched" })
+	})
+}
+
+func TestSetVarFuncNilProvider(t *testing.T) {
+	variable := "unpatched"
+
+	assert.PanicsWithValue(t, "cannot use nil provider passed to SetVarFunc!", func() {
+		SetVarFunc(&variable, nil)
+	})
+}
+
+func TestVariableSetterValue(t *testing.T) {
+	variable := "unpatched"
+	vs := SetVar(&variable, "patched")
+
+	assert.Equal(t, "patched", vs.Value())
+}
+
+func TestVariableSetterValueNotComputed(t *testing.T) {
+	variable := "unpatched"
+	vs := SetVarFunc(&variable, func() string { return "patched" })
+
+	assert.Nil(t, vs.Value())
+}
+
+func TestVariableSetterInstallProvider(t *testing.T) {
+	variable := "unpatched"
+	calls := 0
+	vs := SetVarFunc(&variable, func() string {
+		calls++
+		return fmt.Sprintf("%s-%d", variable, calls)
+	})
+
+	vs.Install()
+
+	assert.Equal(t, "unpatched-1", variable)
+	assert.Equal(t, "unpatched-1", vs.Value())
+	assert.Equal(t, "unpatched", vs.original.Interface())
+
+	vs.Install()
+	vs.Restore()
+	vs.Install()
+
+	assert.Equal(t, "unpatched-2", variable)
+	assert.Equal(t, "unpatched-2", vs.Value())
+	vs.Restore()
+
+	assert.Equal(t, "unpatched", variable)
+	assert.Equal(t, "unpatched-2", vs.Value())
+}
+
+func TestVariableSetterInstallProviderNilInterface(t *testing.T) {
+	variable := assert.AnError
+	vs := SetVarFunc(&variable, func() error { return nil })
+
+	vs.Install()
+
+	assert.Nil(t, variable)
+	assert.Nil(t, vs.Value())
+	vs.Restore()
+	assert.Same(t, assert.AnError, variable)
+}
+
+func TestVariableSetterInstallProviderOrder(t *testing.T) {
+	first := "unpatched"
+	second := "unpatched"
+
+	defer NewPatchMaster(
+		SetVar(&first, "patched"),
+		SetVarFunc(&second, func() string { return first }),
+	).Install().Restore()
+
+	assert.Equal(t, "patched", second)
+}
+
 func TestVariableSetterInstallBase(t *testing.T) {
 	variable := "unpatched"
 	vs := SetVar(&variable, "patched")
@@ -90,6 +181,17 @@ func TestVariableSetterInstallBase(t *testing.T) {
 	assert.True(t, vs.applied)
 }
 
+func TestVariableSetterInstallNilInterface(t *testing.T) {
+	var variable error
+	vs := SetVar(&variable, assert.AnError)
+
+	vs.Install()
+	assert.Same(t, assert.AnError, variable)
+	vs.Restore()
+
+	assert.Nil(t, variable)
+}
+
 func TestVariableSetterInstallIdempotent(t *testing.T) {
 	variable := "unpatched"
 	vs := SetVar(&variable, "patched")
@@ -147,3 +249,201 @@ func TestVariableSetterFunction(t *testing.T) {
 
 	assert.Equal(t, "unpatched", testingVar)
 }
+
+func TestVariableSetterConcurrent(t *testing.T) {
+	variable := "unpatched"
+
+	hammer(SetVar(&variable, "patched"))
+
+	assert.Equal(t, "unpatched", variable)
+}
+
+type tamperRecorder struct {
+	messages []string
+}
+
+func (tr *tamperRecorder) report(msg string) {
+	tr.messages = append(tr.messages, msg)
+}
+
+func TestVariableSetterDetectTampering(t *testing.T) {
+	variable := "unpatched"
+	vs := SetVar(&variable, "patched")
+
+	result := vs.DetectTampering(TamperPanic)
+
+	assert.Same(t, vs, result)
+	assert.NotNil(t, vs.reporter)
+}
+
+func TestVariableSetterTamperUnchanged(t *testing.T) {
+	variable := map[string]int{"a": 1}
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, map[string]int{"a": 2}).DetectTampering(tr.report)
+
+	vs.Install()
+	vs.Restore()
+
+	assert.Equal(t, map[string]int{"a": 1}, variable)
+	assert.Nil(t, tr.messages)
+}
+
+func TestVariableSetterTamperReplaced(t *testing.T) {
+	variable := "unpatched"
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, "patched").DetectTampering(tr.report)
+
+	vs.Install()
+	variable = "tampered"
+	vs.Restore()
+
+	assert.Equal(t, "unpatched", variable)
+	assert.Equal(t, []string{"variable of type string was changed while patched:\n--- patched\n+++ current\n@@ -1 +1 @@\n-(string) (len=7) \"patched\"\n+(string) (len=8) \"tampered\"\n"}, tr.messages)
+}
+
+func TestVariableSetterTamperMutated(t *testing.T) {
+	variable := map[string]int{"a": 1}
+	value := map[string]int{"a": 2}
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, value).DetectTampering(tr.report)
+
+	vs.Install()
+	value["a"] = 3
+	vs.Restore()
+
+	assert.Equal(t, map[string]int{"a": 1}, variable)
+	assert.Equal(t, []string{"variable of type map[string]int was changed while patched:\n--- patched\n+++ current\n@@ -1,3 +1,3 @@\n (map[string]int) (len=1) {\n-  (string) (len=1) \"a\": (int) 2\n+  (string) (len=1) \"a\": (int) 3\n }\n"}, tr.messages)
+}
+
+func TestVariableSetterTamperFunction(t *testing.T) {
+	fn := func() int { return 1 }
+	tr := &tamperRecorder{}
+	vs := SetVar(&fn, func() int { return 2 }).DetectTampering(tr.report)
+
+	vs.Install()
+	vs.Restore()
+	vs.Install()
+	fn = func() int { return 3 }
+	vs.Restore()
+
+	assert.Equal(t, 1, fn())
+	assert.Len(t, tr.messages, 1)
+}
+
+func TestVariableSetterTamperPointer(t *testing.T) {
+	type config struct {
+		Name  string
+		Count int
+	}
+	var variable *config
+	value := &config{Name: "test", Count: 1}
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, value).DetectTampering(tr.report)
+
+	vs.Install()
+	value.Count = 2
+	vs.Restore()
+
+	assert.Nil(t, variable)
+	assert.Len(t, tr.messages, 1)
+	assert.Contains(t, tr.messages[0], "-  Count: (int) 1\n+  Count: (int) 2\n")
+	assert.NotContains(t, tr.messages[0], "0x")
+}
+
+func TestVariableSetterTamperClosure(t *testing.T) {
+	mk := func(x int) func() int {
+		return func() int { return x }
+	}
+	fn := mk(0)
+	tr := &tamperRecorder{}
+	vs := SetVar(&fn, mk(1)).DetectTampering(tr.report)
+
+	vs.Install()
+	fn = mk(2)
+	vs.Restore()
+
+	assert.Equal(t, 0, fn())
+	assert.Len(t, tr.messages, 1)
+}
+
+func TestVariableSetterTamperEqualPointer(t *testing.T) {
+	type config struct {
+		Count int
+	}
+	var variable *config
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, &config{Count: 1}).DetectTampering(tr.report)
+
+	vs.Install()
+	variable = &config{Count: 1}
+	vs.Restore()
+
+	assert.Nil(t, variable)
+	assert.Len(t, tr.messages, 1)
+	assert.Contains(t, tr.messages[0], "was replaced by an identical-looking value while patched")
+}
+
+func TestVariableSetterTamperInterfacePointer(t *testing.T) {
+	var variable interface{}
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, &struct{ Count int }{1}).DetectTampering(tr.report)
+
+	vs.Install()
+	variable = &struct{ Count int }{1}
+	vs.Restore()
+
+	assert.Nil(t, variable)
+	assert.Len(t, tr.messages, 1)
+}
+
+func TestVariableSetterTamperNaN(t *testing.T) {
+	variable := 0.0
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, math.NaN()).DetectTampering(tr.report)
+
+	vs.Install()
+	vs.Restore()
+
+	assert.Equal(t, 0.0, variable)
+	assert.Nil(t, tr.messages)
+}
+
+func TestVariableSetterTamperInstalledBeforeReporter(t *testing.T) {
+	variable := "unpatched"
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, "patched")
+
+	vs.Install()
+	vs.DetectTampering(tr.report)
+	variable = "tampered"
+	vs.Restore()
+
+	assert.Equal(t, "unpatched", variable)
+	assert.Len(t, tr.messages, 1)
+}
+
+func TestVariableSetterTamperInstalledBeforeReporterUnchanged(t *testing.T) {
+	variable := "unpatched"
+	tr := &tamperRecorder{}
+	vs := SetVar(&variable, "patched")
+
+	vs.Install()
+	vs.DetectTampering(tr.report)
+	vs.Restore()
+
+	assert.Equal(t, "unpatched", variable)
+	assert.Nil(t, tr.messages)
+}
+
+func TestVariableSetterTamperPanic(t *testing.T) {
+	variable := "unpatched"
+	vs := SetVar(&variable, "patched").DetectTampering(TamperPanic)
+	vs.Install()
+	variable = "tampered"
+
+	assert.Panics(t, func() {
+		vs.Restore()
+	})
+	assert.Equal(t, "unpatched", variable)
+	assert.False(t, vs.applied)
+}
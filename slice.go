@@ -0,0 +1,170 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// SlicePatcher is a patcher that, given a pointer to a slice
+// variable, will set that variable to a modified copy of the slice.
+// The copy never shares its backing array with the original slice,
+// and the original contents of the backing array are put back when
+// the patch is restored, so mutations through aliases of either slice
+// do not leak past the restore.
+type SlicePatcher struct {
+	lock    sync.Mutex
+	install func() func()
+	restore func()
+	applied bool
+}
+
+// newSlicePatcher constructs a SlicePatcher.  The operation is passed
+// a copy of the slice, and returns the patched slice.
+func newSlicePatcher[S ~[]E, E any](variable *S, op func(patched S) S) *SlicePatcher {
+	return &SlicePatcher{
+		install: func() func() {
+			// Save the slice and its contents
+			original := *variable
+			contents := slices.Clone(original)
+
+			*variable = op(slices.Clone(original))
+
+			return func() {
+				copy(original, contents)
+				*variable = original
+			}
+		},
+	}
+}
+
+// AppendSlice constructs a SlicePatcher that appends items to a
+// slice.  It could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer AppendSlice(&middleware, recordRequests).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func AppendSlice[S ~[]E, E any](variable *S, items ...E) *SlicePatcher {
+	return newSlicePatcher(variable, func(patched S) S {
+		return append(patched, items...)
+	})
+}
+
+// RemoveFromSlice constructs a SlicePatcher that removes all the
+// elements of a slice for which the predicate returns true.  It could
+// be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer RemoveFromSlice(&plugins, func(p Plugin) bool {
+//			return p.Name() == "metrics"
+//		}).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func RemoveFromSlice[S ~[]E, E any](variable *S, predicate func(E) bool) *SlicePatcher {
+	if predicate == nil {
+		panic("cannot use nil predicate passed to RemoveFromSlice!")
+	}
+
+	return newSlicePatcher(variable, func(patched S) S {
+		return slices.DeleteFunc(patched, predicate)
+	})
+}
+
+// SetSliceElem constructs a SlicePatcher that replaces the element of
+// a slice at the specified index.  Installing the patch will panic if
+// the index is out of range.  It could be used in a test function
+// like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer SetSliceElem(&resolvers, 0, fakeResolver).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func SetSliceElem[S ~[]E, E any](variable *S, index int, value E) *SlicePatcher {
+	if index < 0 {
+		panic(fmt.Sprintf("cannot set slice element %d: negative index", index))
+	}
+
+	return newSlicePatcher(variable, func(patched S) S {
+		if index >= len(patched) {
+			panic(fmt.Sprintf("cannot set slice element %d: index out of range with length %d", index, len(patched)))
+		}
+		patched[index] = value
+		return patched
+	})
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (sp *SlicePatcher) Install() Patcher {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	// Be idempotent
+	if sp.applied {
+		return sp
+	}
+
+	// Patch the slice and save the function to restore it
+	sp.restore = sp.install()
+	sp.applied = true
+
+	return sp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (sp *SlicePatcher) Restore() Patcher {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	// Be idempotent
+	if !sp.applied {
+		return sp
+	}
+
+	// Restore the slice and its contents
+	sp.restore()
+	sp.restore = nil
+	sp.applied = false
+
+	return sp
+}
+
+// Global implements GlobalPatcher.  A SlicePatcher always touches
+// process-global state: besides replacing the slice variable, Restore
+// copies the original contents back into the original backing array,
+// which may be shared by other copies of the slice.
+func (sp *SlicePatcher) Global() bool {
+	return true
+}
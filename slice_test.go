@@ -0,0 +1,176 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sliceChain []string
+
+func TestSlicePatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*GlobalPatcher)(nil), &SlicePatcher{})
+}
+
+func TestAppendSlice(t *testing.T) {
+	s := []int{1, 2}
+	sp := AppendSlice(&s, 3, 4)
+
+	result := sp.Install()
+
+	assert.Same(t, sp, result)
+	assert.Equal(t, []int{1, 2, 3, 4}, s)
+	assert.True(t, sp.applied)
+
+	result = sp.Restore()
+
+	assert.Same(t, sp, result)
+	assert.Equal(t, []int{1, 2}, s)
+	assert.False(t, sp.applied)
+}
+
+func TestAppendSliceNil(t *testing.T) {
+	var s sliceChain
+	sp := AppendSlice(&s, "one")
+
+	sp.Install()
+
+	assert.Equal(t, sliceChain{"one"}, s)
+
+	sp.Restore()
+
+	assert.Nil(t, s)
+}
+
+func TestAppendSliceSpareCapacity(t *testing.T) {
+	backing := []int{1, 2, 0, 0}
+	s := backing[:2]
+	sp := AppendSlice(&s, 3)
+
+	sp.Install()
+	s[0] = 100
+	s = append(s, 4)
+	sp.Restore()
+
+	assert.Equal(t, []int{1, 2}, s)
+	assert.Equal(t, []int{1, 2, 0, 0}, backing)
+}
+
+func TestRemoveFromSlice(t *testing.T) {
+	s := sliceChain{"one", "two", "three", "two"}
+	sp := RemoveFromSlice(&s, func(e string) bool { return e == "two" })
+
+	sp.Install()
+
+	assert.Equal(t, sliceChain{"one", "three"}, s)
+
+	sp.Restore()
+
+	assert.Equal(t, sliceChain{"one", "two", "three", "two"}, s)
+}
+
+func TestRemoveFromSliceNilPredicate(t *testing.T) {
+	s := []int{1}
+
+	assert.PanicsWithValue(t, "cannot use nil predicate passed to RemoveFromSlice!", func() {
+		RemoveFromSlice(&s, nil)
+	})
+}
+
+func TestSetSliceElem(t *testing.T) {
+	s := []int{1, 2, 3}
+	alias := s
+	sp := SetSliceElem(&s, 1, 5)
+
+	sp.Install()
+
+	assert.Equal(t, []int{1, 5, 3}, s)
+	assert.Equal(t, []int{1, 2, 3}, alias)
+
+	sp.Restore()
+
+	assert.Equal(t, []int{1, 2, 3}, s)
+}
+
+func TestSetSliceElemNegative(t *testing.T) {
+	s := []int{1}
+
+	assert.PanicsWithValue(t, "cannot set slice element -1: negative index", func() {
+		SetSliceElem(&s, -1, 5)
+	})
+}
+
+func TestSetSliceElemOutOfRange(t *testing.T) {
+	s := []int{1}
+	sp := SetSliceElem(&s, 1, 5)
+
+	assert.PanicsWithValue(t, "cannot set slice element 1: index out of range with length 1", func() {
+		sp.Install()
+	})
+	assert.False(t, sp.applied)
+	assert.Equal(t, []int{1}, s)
+}
+
+func TestSlicePatcherRestoresContents(t *testing.T) {
+	s := []int{1, 2, 3}
+	alias := s
+	sp := SetSliceElem(&s, 0, 5)
+
+	sp.Install()
+	alias[1] = 100
+	sp.Restore()
+
+	assert.Equal(t, []int{1, 2, 3}, s)
+	assert.Equal(t, []int{1, 2, 3}, alias)
+}
+
+func TestSlicePatcherInstallIdempotent(t *testing.T) {
+	s := []int{1}
+	sp := AppendSlice(&s, 2)
+	sp.Install()
+
+	result := sp.Install()
+
+	assert.Same(t, sp, result)
+	assert.Equal(t, []int{1, 2}, s)
+	sp.Restore()
+	assert.Equal(t, []int{1}, s)
+}
+
+func TestSlicePatcherRestoreIdempotent(t *testing.T) {
+	s := []int{1}
+	sp := AppendSlice(&s, 2)
+
+	result := sp.Restore()
+
+	assert.Same(t, sp, result)
+	assert.Equal(t, []int{1}, s)
+}
+
+func TestSlicePatcherGlobal(t *testing.T) {
+	s := []int{1}
+
+	assert.True(t, AppendSlice(&s, 2).Global())
+}
+
+func TestSlicePatcherConcurrent(t *testing.T) {
+	s := []int{1}
+
+	hammer(AppendSlice(&s, 2))
+
+	assert.Equal(t, []int{1}, s)
+}
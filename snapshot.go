@@ -0,0 +1,241 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// copyKey identifies a pointer, map, or slice that has already been
+// copied by a deepCopier.
+type copyKey struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+	cap int
+}
+
+// deepCopier makes deep copies of values.  Pointers, maps, and slices
+// that are reached more than once, including through cycles, are
+// copied only once, so the copy has the same shape as the original.
+type deepCopier struct {
+	seen map[copyKey]reflect.Value
+}
+
+// deepCopy makes a deep copy of a value.  The copy is never the value
+// itself, even if it contains nothing that needs to be copied.
+func deepCopy(v reflect.Value) reflect.Value {
+	dc := &deepCopier{
+		seen: map[copyKey]reflect.Value{},
+	}
+
+	result := reflect.New(v.Type()).Elem()
+	result.Set(dc.copy(v))
+	return result
+}
+
+// accessible returns a version of an addressable value that may be
+// used even if it was obtained through unexported struct fields.
+func accessible(v reflect.Value) reflect.Value {
+	if v.CanInterface() {
+		return v
+	}
+
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem() //nolint:gosec // copies unexported fields
+}
+
+// addressable returns an addressable version of a value, copying it
+// if necessary.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return accessible(v)
+	}
+
+	tmp := reflect.New(v.Type()).Elem()
+	tmp.Set(v)
+	return tmp
+}
+
+// copy makes a deep copy of a value.  Functions and channels cannot
+// be copied, and are shared with the original, as are map keys.
+func (dc *deepCopier) copy(v reflect.Value) reflect.Value {
+	typ := v.Type()
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(typ)
+		}
+		key := copyKey{typ: typ, ptr: v.Pointer()}
+		if result, ok := dc.seen[key]; ok {
+			return result
+		}
+		result := reflect.New(typ.Elem())
+		dc.seen[key] = result
+		result.Elem().Set(dc.copy(accessible(v.Elem())))
+		return result
+
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(typ)
+		}
+		key := copyKey{typ: typ, ptr: v.Pointer()}
+		if result, ok := dc.seen[key]; ok {
+			return result
+		}
+		result := reflect.MakeMapWithSize(typ, v.Len())
+		dc.seen[key] = result
+		for iter := v.MapRange(); iter.Next(); {
+			result.SetMapIndex(iter.Key(), dc.copy(iter.Value()))
+		}
+		return result
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(typ)
+		}
+		key := copyKey{typ: typ, ptr: v.Pointer(), len: v.Len(), cap: v.Cap()}
+		if result, ok := dc.seen[key]; ok {
+			return result
+		}
+		result := reflect.MakeSlice(typ, v.Len(), v.Cap())
+		dc.seen[key] = result
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(dc.copy(accessible(v.Index(i))))
+		}
+		return result
+
+	case reflect.Array:
+		src := addressable(v)
+		result := reflect.New(typ).Elem()
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(dc.copy(accessible(src.Index(i))))
+		}
+		return result
+
+	case reflect.Struct:
+		src := addressable(v)
+		result := reflect.New(typ).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			accessible(result.Field(i)).Set(dc.copy(accessible(src.Field(i))))
+		}
+		return result
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(typ)
+		}
+		result := reflect.New(typ).Elem()
+		result.Set(dc.copy(addressable(v.Elem())))
+		return result
+
+	case reflect.Invalid, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String,
+		reflect.Func, reflect.Chan, reflect.UnsafePointer:
+	}
+
+	// Everything else is shared with the original
+	return v
+}
+
+// SnapshotPatcher is a patcher that, given a pointer to a variable,
+// takes a deep copy of the variable's value when installed, and sets
+// the variable back to that copy when restored.
+type SnapshotPatcher struct {
+	lock     sync.Mutex
+	variable reflect.Value
+	snapshot reflect.Value
+	applied  bool
+}
+
+// Snapshot constructs a SnapshotPatcher, storing the variable.  Unlike
+// the original value saved by SetVar, which shares maps, slices, and
+// pointed-to values with the variable, the snapshot is a deep copy,
+// including unexported struct fields, so changes made in place by the
+// code under test do not survive the restore.  Functions, channels,
+// and map keys are not copied.  Since the variable is set to the copy,
+// other references to the original value still see the changes.  It
+// could be used in a test function like so:
+//
+//	func TestDoSomething(t *testing.T) {
+//		defer Snapshot(&registry).Install().Restore()
+//
+//		err := DoSomething()
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func Snapshot(variable interface{}) *SnapshotPatcher {
+	// Select the variable and validate it's a settable object
+	varReflect := reflect.ValueOf(variable)
+	if varReflect.Kind() != reflect.Ptr || varReflect.IsNil() {
+		panic("cannot snapshot variable passed to Snapshot!")
+	}
+
+	return &SnapshotPatcher{
+		variable: varReflect.Elem(),
+	}
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (sp *SnapshotPatcher) Install() Patcher {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	// Be idempotent
+	if sp.applied {
+		return sp
+	}
+
+	// Take a deep copy of the variable's value
+	sp.snapshot = deepCopy(sp.variable)
+	sp.applied = true
+
+	return sp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (sp *SnapshotPatcher) Restore() Patcher {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	// Be idempotent
+	if !sp.applied {
+		return sp
+	}
+
+	// Set the variable to the snapshot and clear the applied flag
+	sp.variable.Set(sp.snapshot)
+	sp.snapshot = reflect.Value{}
+	sp.applied = false
+
+	return sp
+}
+
+// Global implements GlobalPatcher.  The variable a SnapshotPatcher
+// restores may just as easily be local to a test as package-level
+// state, and everything reachable from it through pointers, maps, and
+// slices is restored as well, so it cannot tell whether it touches
+// process-global state; it conservatively reports that it does.
+func (sp *SnapshotPatcher) Global() bool {
+	return true
+}
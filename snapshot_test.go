@@ -0,0 +1,222 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type snapshotNode struct {
+	Name  string
+	next  *snapshotNode
+	tags  []string
+	attrs map[string]interface{}
+	pair  [2]*int
+	value interface{}
+	fn    func() int
+}
+
+func TestSnapshotPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*GlobalPatcher)(nil), &SnapshotPatcher{})
+}
+
+func TestDeepCopyScalars(t *testing.T) {
+	for _, value := range []interface{}{5, "string", 1.5, true, [2]int{1, 2}, struct{ a, b int }{1, 2}} {
+		result := deepCopy(reflect.ValueOf(value))
+
+		assert.Equal(t, value, result.Interface())
+	}
+}
+
+func TestDeepCopyNil(t *testing.T) {
+	for _, value := range []interface{}{(*int)(nil), map[string]int(nil), []int(nil), [1]error{}} {
+		result := deepCopy(reflect.ValueOf(value))
+
+		assert.Equal(t, value, result.Interface())
+	}
+}
+
+func TestDeepCopyNotSame(t *testing.T) {
+	variable := 5
+	v := reflect.ValueOf(&variable).Elem()
+
+	result := deepCopy(v)
+	variable = 6
+
+	assert.Equal(t, 5, result.Interface())
+}
+
+func TestDeepCopyMap(t *testing.T) {
+	original := map[string][]int{"a": {1, 2}}
+
+	result := deepCopy(reflect.ValueOf(original)).Interface().(map[string][]int)
+	original["a"][0] = 100
+	original["b"] = nil
+
+	assert.Equal(t, map[string][]int{"a": {1, 2}}, result)
+}
+
+func TestDeepCopySlice(t *testing.T) {
+	original := make([]*int, 2, 4)
+	original[0] = new(int)
+	original[1] = original[0]
+
+	result := deepCopy(reflect.ValueOf(original)).Interface().([]*int)
+	*original[0] = 5
+
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, 4, cap(result))
+	assert.Equal(t, 0, *result[0])
+	assert.Same(t, result[0], result[1])
+}
+
+func TestDeepCopyUnexported(t *testing.T) {
+	one := 1
+	original := &snapshotNode{
+		Name:  "node",
+		tags:  []string{"tag"},
+		attrs: map[string]interface{}{"key": []int{1}},
+		pair:  [2]*int{&one, nil},
+		value: &snapshotNode{Name: "inner"},
+	}
+
+	result := deepCopy(reflect.ValueOf(original)).Interface().(*snapshotNode)
+	original.tags[0] = "changed"
+	original.attrs["key"].([]int)[0] = 100
+	*original.pair[0] = 100
+	original.value.(*snapshotNode).Name = "changed"
+
+	assert.NotSame(t, original, result)
+	assert.Equal(t, "node", result.Name)
+	assert.Equal(t, []string{"tag"}, result.tags)
+	assert.Equal(t, map[string]interface{}{"key": []int{1}}, result.attrs)
+	assert.Equal(t, 1, *result.pair[0])
+	assert.Nil(t, result.pair[1])
+	assert.Equal(t, "inner", result.value.(*snapshotNode).Name)
+}
+
+func TestDeepCopyCycles(t *testing.T) {
+	original := &snapshotNode{Name: "one", attrs: map[string]interface{}{}}
+	original.next = &snapshotNode{Name: "two", next: original}
+	original.attrs["self"] = original.attrs
+
+	result := deepCopy(reflect.ValueOf(original)).Interface().(*snapshotNode)
+
+	assert.NotSame(t, original, result)
+	assert.NotSame(t, original.next, result.next)
+	assert.Equal(t, "two", result.next.Name)
+	assert.Same(t, result, result.next.next)
+	assert.Equal(t, reflect.ValueOf(result.attrs).Pointer(), reflect.ValueOf(result.attrs["self"]).Pointer())
+	assert.NotEqual(t, reflect.ValueOf(original.attrs).Pointer(), reflect.ValueOf(result.attrs).Pointer())
+}
+
+func TestDeepCopyFunc(t *testing.T) {
+	original := &snapshotNode{fn: func() int { return 5 }}
+
+	result := deepCopy(reflect.ValueOf(original)).Interface().(*snapshotNode)
+
+	assert.Equal(t, 5, result.fn())
+}
+
+func TestSnapshot(t *testing.T) {
+	variable := map[string]int{}
+
+	result := Snapshot(&variable)
+
+	assert.Equal(t, reflect.ValueOf(&variable).Elem(), result.variable)
+	assert.False(t, result.snapshot.IsValid())
+	assert.False(t, result.applied)
+}
+
+func TestSnapshotNotPointer(t *testing.T) {
+	assert.PanicsWithValue(t, "cannot snapshot variable passed to Snapshot!", func() {
+		Snapshot(map[string]int{})
+	})
+}
+
+func TestSnapshotNilPointer(t *testing.T) {
+	assert.PanicsWithValue(t, "cannot snapshot variable passed to Snapshot!", func() {
+		Snapshot((*map[string]int)(nil))
+	})
+}
+
+func TestSnapshotPatcherInstallRestore(t *testing.T) {
+	variable := map[string]*snapshotNode{"a": {Name: "a", tags: []string{"x"}}}
+	sp := Snapshot(&variable)
+
+	result := sp.Install()
+
+	assert.Same(t, sp, result)
+	assert.True(t, sp.applied)
+
+	variable["a"].tags[0] = "changed"
+	variable["b"] = &snapshotNode{}
+	result = sp.Restore()
+
+	assert.Same(t, sp, result)
+	assert.False(t, sp.applied)
+	assert.Equal(t, map[string]*snapshotNode{"a": {Name: "a", tags: []string{"x"}}}, variable)
+}
+
+func TestSnapshotPatcherScalar(t *testing.T) {
+	variable := "original"
+	sp := Snapshot(&variable)
+
+	sp.Install()
+	variable = "changed"
+	sp.Restore()
+
+	assert.Equal(t, "original", variable)
+}
+
+func TestSnapshotPatcherInstallIdempotent(t *testing.T) {
+	variable := []int{1}
+	sp := Snapshot(&variable)
+	sp.Install()
+	variable[0] = 2
+
+	result := sp.Install()
+
+	assert.Same(t, sp, result)
+	sp.Restore()
+	assert.Equal(t, []int{1}, variable)
+}
+
+func TestSnapshotPatcherRestoreIdempotent(t *testing.T) {
+	variable := []int{1}
+	sp := Snapshot(&variable)
+
+	result := sp.Restore()
+
+	assert.Same(t, sp, result)
+	assert.Equal(t, []int{1}, variable)
+}
+
+func TestSnapshotPatcherGlobal(t *testing.T) {
+	variable := []int{1}
+
+	assert.True(t, Snapshot(&variable).Global())
+}
+
+func TestSnapshotPatcherConcurrent(t *testing.T) {
+	variable := map[string]int{"a": 1}
+
+	hammer(Snapshot(&variable))
+
+	assert.Equal(t, map[string]int{"a": 1}, variable)
+}
@@ -0,0 +1,340 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// SweepOutcome describes the outcome of a test run by Sweep.
+type SweepOutcome int
+
+// Outcomes of a test run by Sweep.
+const (
+	SweepPassed   SweepOutcome = iota // The test passed
+	SweepFailed                       // The test failed
+	SweepPanicked                     // The test panicked
+	SweepSkipped                      // The test was skipped
+)
+
+// String returns a string describing the outcome.
+func (so SweepOutcome) String() string {
+	switch so {
+	case SweepPassed:
+		return "passed"
+	case SweepFailed:
+		return "failed"
+	case SweepPanicked:
+		return "panicked"
+	case SweepSkipped:
+		return "skipped"
+	}
+
+	return fmt.Sprintf("SweepOutcome(%d)", int(so))
+}
+
+// SweepResult describes the result of running a test with an error
+// injected into a single patch point.
+type SweepResult struct {
+	Point    string       // The name of the patch point
+	Outcome  SweepOutcome // The outcome of the test
+	Injected bool         // Whether the error was injected
+	Panic    interface{}  // The panic value, if the test panicked
+	Messages []string     // Messages logged by the test
+}
+
+// sweepTB is the testing.TB passed to a test run by Sweep.  It
+// records failures instead of reporting them to the enclosing test.
+// Methods it does not override are passed to the enclosing test.
+type sweepTB struct {
+	testing.TB
+	lock     sync.Mutex
+	name     string
+	failed   bool
+	skipped  bool
+	messages []string
+	cleanups []func()
+}
+
+// Name returns the name of the test.
+func (st *sweepTB) Name() string {
+	return st.name
+}
+
+// Helper marks the calling function as a test helper function.  It
+// does nothing.
+func (st *sweepTB) Helper() {}
+
+// Log records a message.
+func (st *sweepTB) Log(args ...interface{}) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.messages = append(st.messages, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+// Logf records a formatted message.
+func (st *sweepTB) Logf(format string, args ...interface{}) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.messages = append(st.messages, fmt.Sprintf(format, args...))
+}
+
+// Fail marks the test as failed.
+func (st *sweepTB) Fail() {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.failed = true
+}
+
+// Failed reports whether the test has failed.
+func (st *sweepTB) Failed() bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	return st.failed
+}
+
+// FailNow marks the test as failed and stops its execution.
+func (st *sweepTB) FailNow() {
+	st.Fail()
+	runtime.Goexit()
+}
+
+// Error is equivalent to Log followed by Fail.
+func (st *sweepTB) Error(args ...interface{}) {
+	st.Log(args...)
+	st.Fail()
+}
+
+// Errorf is equivalent to Logf followed by Fail.
+func (st *sweepTB) Errorf(format string, args ...interface{}) {
+	st.Logf(format, args...)
+	st.Fail()
+}
+
+// Fatal is equivalent to Log followed by FailNow.
+func (st *sweepTB) Fatal(args ...interface{}) {
+	st.Log(args...)
+	st.FailNow()
+}
+
+// Fatalf is equivalent to Logf followed by FailNow.
+func (st *sweepTB) Fatalf(format string, args ...interface{}) {
+	st.Logf(format, args...)
+	st.FailNow()
+}
+
+// SkipNow marks the test as skipped and stops its execution.
+func (st *sweepTB) SkipNow() {
+	st.lock.Lock()
+	st.skipped = true
+	st.lock.Unlock()
+
+	runtime.Goexit()
+}
+
+// Skip is equivalent to Log followed by SkipNow.
+func (st *sweepTB) Skip(args ...interface{}) {
+	st.Log(args...)
+	st.SkipNow()
+}
+
+// Skipf is equivalent to Logf followed by SkipNow.
+func (st *sweepTB) Skipf(format string, args ...interface{}) {
+	st.Logf(format, args...)
+	st.SkipNow()
+}
+
+// Skipped reports whether the test was skipped.
+func (st *sweepTB) Skipped() bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	return st.skipped
+}
+
+// Cleanup registers a function to be called when the test completes.
+func (st *sweepTB) Cleanup(f func()) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.cleanups = append(st.cleanups, f)
+}
+
+// Setenv sets an environment variable for the duration of the test.
+func (st *sweepTB) Setenv(key, value string) {
+	ep := SetEnv(key, value)
+	ep.Install()
+	st.Cleanup(func() {
+		ep.Restore()
+	})
+}
+
+// runCleanups calls the registered cleanup functions in reverse
+// order.
+func (st *sweepTB) runCleanups() {
+	for {
+		st.lock.Lock()
+		if len(st.cleanups) == 0 {
+			st.lock.Unlock()
+			return
+		}
+		f := st.cleanups[len(st.cleanups)-1]
+		st.cleanups = st.cleanups[:len(st.cleanups)-1]
+		st.lock.Unlock()
+
+		f()
+	}
+}
+
+// run runs a test function in a separate goroutine, so that FailNow
+// and SkipNow may stop it, and returns its result.
+func (st *sweepTB) run(fn func(t testing.TB)) *SweepResult {
+	result := &SweepResult{}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer func() {
+			if panicData := recover(); panicData != nil {
+				result.Outcome = SweepPanicked
+				result.Panic = panicData
+			}
+		}()
+		defer st.runCleanups()
+
+		fn(st)
+	}()
+	<-done
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	switch {
+	case result.Outcome == SweepPanicked:
+	case st.failed:
+		result.Outcome = SweepFailed
+	case st.skipped:
+		result.Outcome = SweepSkipped
+	}
+	result.Messages = st.messages
+
+	return result
+}
+
+// sweepable tests whether a patch point is a function variable with
+// an error return value.
+func sweepable(point PatchPoint) bool {
+	typ := reflect.TypeOf(point.Variable).Elem()
+
+	return typ.Kind() == reflect.Func && errorIndex(typ) >= 0
+}
+
+// sweepPoints selects the patch points to sweep.  It fails the test
+// and returns false if a specified patch point cannot be swept.
+func sweepPoints(t testing.TB, names []string) ([]PatchPoint, bool) {
+	t.Helper()
+
+	if len(names) == 0 {
+		selected := []PatchPoint{}
+		for _, point := range Points() {
+			if sweepable(point) {
+				selected = append(selected, point)
+			}
+		}
+
+		return selected, true
+	}
+
+	selected := make([]PatchPoint, 0, len(names))
+	for _, name := range names {
+		point, ok := points.lookup(name)
+		switch {
+		case !ok:
+			t.Fatalf("cannot sweep patch point %q: not registered", name)
+			return nil, false
+		case !sweepable(point):
+			t.Fatalf("cannot sweep patch point %q: not a function returning an error", name)
+			return nil, false
+		}
+		selected = append(selected, point)
+	}
+
+	return selected, true
+}
+
+// Sweep runs a test function once for each of the specified
+// registered patch points, or for every registered function patch
+// point with an error return value if none are specified.  On each
+// run, the patch point is wrapped, using Faults, to return an error
+// wrapping ErrInjected on its first call.  The test function is
+// passed a testing.TB that records failures instead of failing the
+// enclosing test, and the result of each run is returned and logged.
+// This reveals which error paths the test verifies, since it should
+// fail, and which errors are silently swallowed.  Like Apply, Sweep
+// fails the enclosing test if it is running in parallel.  It could be
+// used in a test function like so:
+//
+//	func TestDoSomethingErrors(t *testing.T) {
+//		for _, result := range Sweep(t, func(t testing.TB) {
+//			if err := DoSomething("some-filename"); err != nil {
+//				t.Fatal(err)
+//			}
+//		}) {
+//			if result.Injected && result.Outcome != SweepFailed {
+//				t.Errorf("error from %s was swallowed", result.Point)
+//			}
+//		}
+//	}
+func Sweep(t testing.TB, fn func(t testing.TB), names ...string) []*SweepResult {
+	t.Helper()
+
+	selected, ok := sweepPoints(t, names)
+	if !ok || !denyParallel(t) {
+		return nil
+	}
+
+	results := make([]*SweepResult, 0, len(selected))
+	for _, point := range selected {
+		fp := Faults(point.Variable, FaultPolicy{
+			Trigger: NthCall(1),
+			Fault:   InjectError(fmt.Errorf("%w: %s", ErrInjected, point.Name)),
+		})
+		pm := NewPatchMaster(fp)
+
+		pm.Install()
+		result := (&sweepTB{TB: t, name: t.Name() + "/sweep/" + point.Name}).run(fn)
+		pm.Restore()
+
+		result.Point = point.Name
+		result.Injected = len(fp.Injections()) > 0
+		if result.Injected {
+			t.Logf("sweep %s: %s", point.Name, result.Outcome)
+		} else {
+			t.Logf("sweep %s: %s (not called)", point.Name, result.Outcome)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
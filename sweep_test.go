@@ -0,0 +1,206 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweepOutcomeString(t *testing.T) {
+	assert.Equal(t, "passed", SweepPassed.String())
+	assert.Equal(t, "failed", SweepFailed.String())
+	assert.Equal(t, "panicked", SweepPanicked.String())
+	assert.Equal(t, "skipped", SweepSkipped.String())
+	assert.Equal(t, "SweepOutcome(99)", SweepOutcome(99).String())
+}
+
+type sweepPointSet struct {
+	load    func(string) ([]byte, error)
+	save    func([]byte) error
+	check   func() error
+	unused  func() error
+	count   int
+	getpid  func() int
+	skipped func() error
+}
+
+func registerSweepPoints(t *testing.T) *sweepPointSet {
+	t.Helper()
+
+	withRegistry(t)
+	sp := &sweepPointSet{
+		load:    func(string) ([]byte, error) { return []byte("data"), nil },
+		save:    func([]byte) error { return nil },
+		check:   func() error { return nil },
+		unused:  func() error { return nil },
+		getpid:  os.Getpid,
+		skipped: func() error { return nil },
+	}
+	Register("test.load", &sp.load)
+	Register("test.save", &sp.save)
+	Register("test.check", &sp.check)
+	Register("test.unused", &sp.unused)
+	Register("test.count", &sp.count)
+	Register("test.getpid", &sp.getpid)
+	Register("test.skipped", &sp.skipped)
+
+	return sp
+}
+
+func (sp *sweepPointSet) test(t testing.TB) {
+	data, err := sp.load("file")
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	_ = sp.save(data)
+	if err := sp.check(); err != nil {
+		panic(err)
+	}
+	if err := sp.skipped(); err != nil {
+		t.Skip("skipping:", err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	sp := registerSweepPoints(t)
+
+	results := Sweep(t, sp.test)
+
+	require.Len(t, results, 5)
+	assert.Equal(t, &SweepResult{Point: "test.check", Outcome: SweepPanicked, Injected: true, Panic: results[0].Panic}, results[0])
+	assert.True(t, errors.Is(results[0].Panic.(error), ErrInjected))
+	assert.Equal(t, &SweepResult{
+		Point:    "test.load",
+		Outcome:  SweepFailed,
+		Injected: true,
+		Messages: []string{"load: injected fault: test.load"},
+	}, results[1])
+	assert.Equal(t, &SweepResult{Point: "test.save", Outcome: SweepPassed, Injected: true}, results[2])
+	assert.Equal(t, &SweepResult{
+		Point:    "test.skipped",
+		Outcome:  SweepSkipped,
+		Injected: true,
+		Messages: []string{"skipping: injected fault: test.skipped"},
+	}, results[3])
+	assert.Equal(t, &SweepResult{Point: "test.unused", Outcome: SweepPassed}, results[4])
+	assert.False(t, t.Failed())
+	_, err := sp.load("file")
+	assert.NoError(t, err)
+}
+
+func TestSweepNamed(t *testing.T) {
+	sp := registerSweepPoints(t)
+
+	results := Sweep(t, sp.test, "test.save", "test.load")
+
+	require.Len(t, results, 2)
+	assert.Equal(t, "test.save", results[0].Point)
+	assert.Equal(t, "test.load", results[1].Point)
+}
+
+func TestSweepUnknownPoint(t *testing.T) {
+	sp := registerSweepPoints(t)
+	tb := &fakeTB{TB: t}
+
+	results := Sweep(tb, sp.test, "test.bogus")
+
+	assert.Nil(t, results)
+	assert.Equal(t, `cannot sweep patch point "test.bogus": not registered`, tb.fatal)
+}
+
+func TestSweepUnsweepablePoint(t *testing.T) {
+	sp := registerSweepPoints(t)
+
+	for _, name := range []string{"test.count", "test.getpid"} {
+		tb := &fakeTB{TB: t}
+
+		results := Sweep(tb, sp.test, name)
+
+		assert.Nil(t, results)
+		assert.Equal(t, `cannot sweep patch point "`+name+`": not a function returning an error`, tb.fatal)
+	}
+}
+
+func TestSweepParallel(t *testing.T) {
+	sp := registerSweepPoints(t)
+
+	t.Run("parallel", func(t *testing.T) {
+		t.Parallel()
+		tb := &fakeTB{TB: t}
+
+		results := Sweep(tb, sp.test)
+
+		assert.Nil(t, results)
+		assert.Contains(t, tb.fatal, "cannot apply patches that touch process-global state")
+	})
+}
+
+func TestSweepTB(t *testing.T) {
+	order := []string{}
+	st := &sweepTB{TB: t, name: "TestSweepTB/sweep"}
+
+	result := st.run(func(tb testing.TB) {
+		tb.Helper()
+		assert.Equal(t, "TestSweepTB/sweep", tb.Name())
+		tb.Cleanup(func() { order = append(order, "first") })
+		tb.Cleanup(func() { order = append(order, "second") })
+		tb.Setenv("PATCHER_SWEEP_TEST", "value")
+		assert.Equal(t, "value", os.Getenv("PATCHER_SWEEP_TEST"))
+		tb.Log("log", 1)
+		tb.Logf("logf %d", 2)
+		assert.False(t, tb.Failed())
+		tb.Error("error", 3)
+		assert.True(t, tb.Failed())
+		tb.Errorf("errorf %d", 4)
+		assert.False(t, tb.Skipped())
+	})
+
+	assert.Equal(t, &SweepResult{
+		Outcome:  SweepFailed,
+		Messages: []string{"log 1", "logf 2", "error 3", "errorf 4"},
+	}, result)
+	assert.Equal(t, []string{"second", "first"}, order)
+	_, ok := os.LookupEnv("PATCHER_SWEEP_TEST")
+	assert.False(t, ok)
+}
+
+func TestSweepTBFatal(t *testing.T) {
+	reached := false
+	st := &sweepTB{TB: t}
+
+	result := st.run(func(tb testing.TB) {
+		tb.Fatal("fatal")
+		reached = true
+	})
+
+	assert.Equal(t, &SweepResult{Outcome: SweepFailed, Messages: []string{"fatal"}}, result)
+	assert.False(t, reached)
+}
+
+func TestSweepTBSkipf(t *testing.T) {
+	st := &sweepTB{TB: t}
+
+	result := st.run(func(tb testing.TB) {
+		tb.Skipf("skip %d", 1)
+	})
+
+	assert.Equal(t, &SweepResult{Outcome: SweepSkipped, Messages: []string{"skip 1"}}, result)
+	assert.True(t, st.Skipped())
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// TamperReporter is a function that reports that a patched value was
+// changed by someone else while the patch was installed.  It is
+// passed a message describing the change, including a diff.  Reporters
+// are called after the patch has been restored.
+type TamperReporter func(msg string)
+
+// TamperTB returns a TamperReporter that reports changes as errors
+// of the specified test.
+func TamperTB(t testing.TB) TamperReporter {
+	return func(msg string) {
+		t.Helper()
+		t.Error(msg)
+	}
+}
+
+// TamperPanic is a TamperReporter that panics with the message.
+func TamperPanic(msg string) {
+	panic(msg)
+}
+
+// TamperLog returns a TamperReporter that logs changes to the
+// specified logger, or to the default logger from the log package if
+// it is nil.
+func TamperLog(logger *log.Logger) TamperReporter {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return func(msg string) {
+		logger.Print(msg)
+	}
+}
+
+// tamperDiff returns a message describing a change to a patched
+// value, including a unified diff between the value set by the patch
+// and the current value.  If both print the same, as when the value
+// is replaced by an equal copy, the message says so instead.
+func tamperDiff(what, patched, current string) string {
+	if patched == current {
+		return fmt.Sprintf("%s was replaced by an identical-looking value while patched:\n%s\n", what, current)
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(patched),
+		B:        difflib.SplitLines(current),
+		FromFile: "patched",
+		ToFile:   "current",
+		Context:  3,
+	})
+
+	return fmt.Sprintf("%s was changed while patched:\n%s", what, diff)
+}
+
+// tamperDumper formats values for tamperDiff.  Values are formatted
+// across multiple lines, following pointers but omitting their
+// addresses, so that the diff shows only the parts that changed.
+var tamperDumper = &spew.ConfigState{
+	Indent:                  "  ",
+	DisablePointerAddresses: true,
+	DisableCapacities:       true,
+	SortKeys:                true,
+}
+
+// tamperDump formats a value for tamperDiff.
+func tamperDump(v reflect.Value) string {
+	return strings.TrimSuffix(tamperDumper.Sdump(v.Interface()), "\n")
+}
+
+// equalFloats compares two floating point numbers for equalValues.
+// Unlike the == operator, it treats NaNs as equal to each other, so
+// that a NaN that was not changed is not reported as tampered.
+func equalFloats(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+// funcIdentity returns a pointer identifying a function value.  Unlike
+// the Pointer method, which returns the address of the function's
+// code, it returns the address of the function value itself, so that
+// closures of the same function literal, or functions created by
+// reflect.MakeFunc, can be told apart.
+func funcIdentity(v reflect.Value) uintptr {
+	if v.IsNil() {
+		return 0
+	}
+	if !v.CanAddr() {
+		if !v.CanInterface() {
+			return v.Pointer()
+		}
+		tmp := reflect.New(v.Type()).Elem()
+		tmp.Set(v)
+		v = tmp
+	}
+
+	return *(*uintptr)(unsafe.Pointer(v.UnsafeAddr())) //nolint:gosec // reads the function value pointer
+}
+
+// sameValue tests whether two values of the same type are the same
+// value, rather than merely equal: pointers, maps, slices, functions,
+// and channels must refer to the same object.  Values of other kinds
+// are considered the same; their contents are compared by
+// equalValues.
+func sameValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+
+	case reflect.Slice:
+		return a.Pointer() == b.Pointer() && a.Len() == b.Len()
+
+	case reflect.Func:
+		return funcIdentity(a) == funcIdentity(b)
+
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return a.Elem().Type() == b.Elem().Type() && sameValue(a.Elem(), b.Elem())
+
+	case reflect.Invalid, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.Array,
+		reflect.String, reflect.Struct:
+		return true
+	}
+
+	panic(fmt.Sprintf("unknown kind %s", a.Kind()))
+}
+
+// visit identifies a pair of pointers, maps, or slices that are
+// being compared by equalValues.
+type visit struct {
+	typ reflect.Type
+	a   uintptr
+	b   uintptr
+}
+
+// compareRefs starts the comparison of two pointers, maps, or slices
+// of the same type.  It returns true and the result if the comparison
+// is already decided, because either is nil, they are the same, or
+// they are already being compared, which handles cycles.
+func compareRefs(a, b reflect.Value, seen map[visit]bool) (bool, bool) {
+	if a.IsNil() || b.IsNil() {
+		return true, a.IsNil() == b.IsNil()
+	}
+
+	key := visit{typ: a.Type(), a: a.Pointer(), b: b.Pointer()}
+	if key.a == key.b || seen[key] {
+		return true, true
+	}
+	seen[key] = true
+
+	return false, false
+}
+
+// equalValues compares two values for deep equality.  It differs from
+// reflect.DeepEqual in that functions are equal if they are the same
+// function value, so a patch that sets a function variable can be
+// checked.
+func equalValues(a, b reflect.Value, seen map[visit]bool) bool {
+	if a.IsValid() != b.IsValid() || (a.IsValid() && a.Type() != b.Type()) {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Invalid:
+		return true
+
+	case reflect.Ptr:
+		if done, equal := compareRefs(a, b, seen); done {
+			return equal
+		}
+		return equalValues(a.Elem(), b.Elem(), seen)
+
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		if done, equal := compareRefs(a, b, seen); done {
+			return equal
+		}
+		for iter := a.MapRange(); iter.Next(); {
+			if !equalValues(iter.Value(), b.MapIndex(iter.Key()), seen) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		if done, equal := compareRefs(a, b, seen); done {
+			return equal
+		}
+		fallthrough
+
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			if !equalValues(a.Index(i), b.Index(i), seen) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !equalValues(a.Field(i), b.Field(i), seen) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equalValues(a.Elem(), b.Elem(), seen)
+
+	case reflect.Func:
+		return funcIdentity(a) == funcIdentity(b)
+
+	case reflect.Chan, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+
+	case reflect.Float32, reflect.Float64:
+		return equalFloats(a.Float(), b.Float())
+
+	case reflect.Complex64, reflect.Complex128:
+		return equalFloats(real(a.Complex()), real(b.Complex())) &&
+			equalFloats(imag(a.Complex()), imag(b.Complex()))
+
+	case reflect.String:
+		return a.String() == b.String()
+	}
+
+	panic(fmt.Sprintf("unknown kind %s", a.Kind()))
+}
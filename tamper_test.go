@@ -0,0 +1,210 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"bytes"
+	"log"
+	"math"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTamperTB(t *testing.T) {
+	tb := &sweepTB{TB: t}
+
+	TamperTB(tb)("message")
+
+	assert.True(t, tb.Failed())
+	assert.Equal(t, []string{"message"}, tb.messages)
+}
+
+func TestTamperPanic(t *testing.T) {
+	assert.PanicsWithValue(t, "message", func() {
+		TamperPanic("message")
+	})
+}
+
+func TestTamperLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	TamperLog(log.New(buf, "", 0))("message")
+
+	assert.Equal(t, "message\n", buf.String())
+}
+
+func TestTamperLogDefault(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defer Log(buf).Install().Restore()
+
+	TamperLog(nil)("message")
+
+	assert.Contains(t, buf.String(), "message\n")
+}
+
+func TestTamperDiff(t *testing.T) {
+	result := tamperDiff("thing", `"patched"`, `"current"`)
+
+	assert.Equal(t, "thing was changed while patched:\n--- patched\n+++ current\n@@ -1 +1 @@\n-\"patched\"\n+\"current\"\n", result)
+}
+
+func TestTamperDiffIdentical(t *testing.T) {
+	result := tamperDiff("thing", `"value"`, `"value"`)
+
+	assert.Equal(t, "thing was replaced by an identical-looking value while patched:\n\"value\"\n", result)
+}
+
+type tamperNode struct {
+	name string
+	next *tamperNode
+}
+
+func closure(x int) func() int {
+	return func() int { return x }
+}
+
+func makeFunc() func() {
+	return reflect.MakeFunc(reflect.TypeOf(func() {}), func([]reflect.Value) []reflect.Value {
+		return nil
+	}).Interface().(func())
+}
+
+func TestFuncIdentity(t *testing.T) {
+	fn := closure(1)
+	other := closure(1)
+	v := reflect.ValueOf(&fn).Elem()
+
+	assert.Equal(t, funcIdentity(v), funcIdentity(reflect.ValueOf(fn)))
+	assert.NotEqual(t, funcIdentity(v), funcIdentity(reflect.ValueOf(other)))
+	assert.Equal(t, uintptr(0), funcIdentity(reflect.ValueOf((func())(nil))))
+}
+
+func TestSameValue(t *testing.T) {
+	ptr := &tamperNode{name: "a"}
+	m := map[string]int{"a": 1}
+	s := []int{1, 2}
+	fn := closure(1)
+	ch := make(chan int)
+	tests := []struct {
+		name string
+		a    interface{}
+		b    interface{}
+		same bool
+	}{
+		{"scalar", 1, 2, true},
+		{"struct", tamperNode{name: "a"}, tamperNode{name: "b"}, true},
+		{"pointer same", ptr, ptr, true},
+		{"pointer equal", ptr, &tamperNode{name: "a"}, false},
+		{"map same", m, m, true},
+		{"map equal", m, map[string]int{"a": 1}, false},
+		{"slice same", s, s, true},
+		{"slice equal", s, []int{1, 2}, false},
+		{"slice shorter", s, s[:1], false},
+		{"func same", fn, fn, true},
+		{"func closure", fn, closure(1), false},
+		{"chan same", ch, ch, true},
+		{"chan different", ch, make(chan int), false},
+		{"interface same", []interface{}{ptr}, []interface{}{ptr}, true},
+		{"interface equal", []interface{}{ptr}, []interface{}{&tamperNode{name: "a"}}, false},
+		{"interface nil", []interface{}{nil}, []interface{}{ptr}, false},
+		{"interface types", []interface{}{1}, []interface{}{"1"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := reflect.ValueOf(test.a)
+			b := reflect.ValueOf(test.b)
+			if a.Kind() == reflect.Slice && a.Type().Elem().Kind() == reflect.Interface {
+				a = a.Index(0)
+				b = b.Index(0)
+			}
+
+			result := sameValue(a, b)
+
+			assert.Equal(t, test.same, result)
+		})
+	}
+}
+
+func TestEqualValues(t *testing.T) {
+	fn1 := func() {}
+	fn2 := func() {}
+	ch := make(chan int)
+	cycle1 := &tamperNode{name: "a"}
+	cycle1.next = cycle1
+	cycle2 := &tamperNode{name: "a"}
+	cycle2.next = cycle2
+	cycle3 := &tamperNode{name: "b"}
+	cycle3.next = cycle3
+	shared := []int{1, 2}
+	tests := []struct {
+		name  string
+		a     interface{}
+		b     interface{}
+		equal bool
+	}{
+		{"nil", nil, nil, true},
+		{"nil and value", nil, 5, false},
+		{"types", 5, int64(5), false},
+		{"bool", true, true, true},
+		{"int", 5, 6, false},
+		{"uint", uint(5), uint(5), true},
+		{"float", 1.5, 1.5, true},
+		{"float different", 1.5, 2.5, false},
+		{"float NaN", math.NaN(), math.NaN(), true},
+		{"float NaN and value", math.NaN(), 1.5, false},
+		{"complex", 1i, 2i, false},
+		{"complex NaN", complex(math.NaN(), 1), complex(math.NaN(), 1), true},
+		{"complex NaN different", complex(math.NaN(), 1), complex(math.NaN(), 2), false},
+		{"string", "a", "a", true},
+		{"func same", fn1, fn1, true},
+		{"func different", fn1, fn2, false},
+		{"func nil", (func())(nil), fn1, false},
+		{"func closure", closure(1), closure(2), false},
+		{"func make", makeFunc(), makeFunc(), false},
+		{"chan", ch, ch, true},
+		{"unsafe pointer", unsafe.Pointer(&ch), unsafe.Pointer(&ch), true},
+		{"pointer", &tamperNode{name: "a"}, &tamperNode{name: "a"}, true},
+		{"pointer nil", (*tamperNode)(nil), &tamperNode{}, false},
+		{"pointer cycle", cycle1, cycle2, true},
+		{"pointer cycle different", cycle1, cycle3, false},
+		{"map", map[string]int{"a": 1}, map[string]int{"a": 1}, true},
+		{"map value", map[string]int{"a": 1}, map[string]int{"a": 2}, false},
+		{"map key", map[string]int{"a": 1}, map[string]int{"b": 1}, false},
+		{"map length", map[string]int{"a": 1}, map[string]int{}, false},
+		{"map nil", map[string]int(nil), map[string]int{}, false},
+		{"slice", []int{1, 2}, []int{1, 2}, true},
+		{"slice same", shared, shared, true},
+		{"slice element", []int{1, 2}, []int{1, 3}, false},
+		{"slice length", []int{1, 2}, []int{1}, false},
+		{"array", [2]int{1, 2}, [2]int{1, 2}, true},
+		{"array element", [2]int{1, 2}, [2]int{1, 3}, false},
+		{"struct unexported", tamperNode{name: "a"}, tamperNode{name: "b"}, false},
+		{"interface", []interface{}{1}, []interface{}{1}, true},
+		{"interface nil", []interface{}{nil}, []interface{}{1}, false},
+		{"interface types", []interface{}{1}, []interface{}{"1"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := equalValues(reflect.ValueOf(test.a), reflect.ValueOf(test.b), map[visit]bool{})
+
+			assert.Equal(t, test.equal, result)
+		})
+	}
+}
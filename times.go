@@ -0,0 +1,164 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// TimesPatcher is a patcher that, given a pointer to a function
+// variable and a replacement function, will set the variable to call
+// the replacement for a limited number of calls.
+type TimesPatcher struct {
+	lock        sync.Mutex
+	n           int
+	variable    reflect.Value
+	replacement reflect.Value
+	original    reflect.Value
+	calls       int
+	applied     bool
+}
+
+// Times constructs a TimesPatcher, storing the number of calls, the
+// function variable, and the replacement function.  While installed,
+// the first n calls to the function call the replacement, and any
+// later calls forward to the original function.  The variable itself
+// is only written by Install and Restore, so it is safe to call the
+// function from multiple goroutines; calls through a copy of the
+// patched variable, including after Restore, also forward to the
+// original.  It will panic if n is not positive, if the variable is
+// not a function variable, or if the replacement cannot be assigned
+// to it.  It could be used in a test function like so:
+//
+//	func TestDoSomethingRetries(t *testing.T) {
+//		defer Times(2, &readFile, func(filename string) ([]byte, error) {
+//			return nil, errors.New("transient failure")
+//		}).Install().Restore()
+//
+//		err := DoSomethingWithRetry("some-filename")
+//
+//		if err != nil {
+//			t.Fail("non-nil error!")
+//		}
+//	}
+func Times(n int, variable, replacement interface{}) *TimesPatcher {
+	if n < 1 {
+		panic(fmt.Sprintf("cannot patch for %d calls", n))
+	}
+
+	// Select the variable and validate it's a function variable
+	varReflect := reflect.ValueOf(variable)
+	if varReflect.Kind() != reflect.Ptr || varReflect.Elem().Kind() != reflect.Func {
+		panic("cannot set variable passed to Times!")
+	}
+	v := varReflect.Elem()
+
+	// Check that the replacement can be assigned to the variable
+	val := reflect.ValueOf(replacement)
+	if !val.IsValid() || !val.Type().AssignableTo(v.Type()) {
+		panic(fmt.Sprintf("cannot assign %T type to variable type %s", replacement, v.Type()))
+	}
+
+	return &TimesPatcher{
+		n:           n,
+		variable:    v,
+		replacement: val,
+	}
+}
+
+// Calls returns the number of calls that called the replacement since
+// the patch was last installed.
+func (tp *TimesPatcher) Calls() int {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	return tp.calls
+}
+
+// selectFunc counts a call and selects the function to call.  The
+// original is selected once the replacement has been called n times
+// or the patch has been restored.
+func (tp *TimesPatcher) selectFunc() reflect.Value {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	if !tp.applied || tp.calls >= tp.n {
+		return tp.original
+	}
+
+	tp.calls++
+
+	return tp.replacement
+}
+
+// call is the implementation of the trampoline function.
+func (tp *TimesPatcher) call(args []reflect.Value) []reflect.Value {
+	fn := tp.selectFunc()
+	if tp.variable.Type().IsVariadic() {
+		return fn.CallSlice(args)
+	}
+
+	return fn.Call(args)
+}
+
+// Install installs the patch.  It should store metadata sufficient to
+// allow Restore to restore the original data.  This method must be
+// idempotent.
+func (tp *TimesPatcher) Install() Patcher {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	// Be idempotent
+	if tp.applied {
+		return tp
+	}
+
+	// Save the original function and reset the counter
+	tp.original = reflect.New(tp.variable.Type()).Elem()
+	tp.original.Set(tp.variable)
+	tp.calls = 0
+
+	// Install the trampoline
+	tp.variable.Set(reflect.MakeFunc(tp.variable.Type(), tp.call))
+	tp.applied = true
+
+	return tp
+}
+
+// Restore uses the metadata stored by Install to restore the patch to
+// its original value.  This method must be idempotent.
+func (tp *TimesPatcher) Restore() Patcher {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	// Be idempotent
+	if !tp.applied {
+		return tp
+	}
+
+	tp.variable.Set(tp.original)
+	tp.applied = false
+
+	return tp
+}
+
+// Global implements GlobalPatcher.  A TimesPatcher always touches
+// process-global state, since its n calls are shared by every caller
+// of the function; a test running in parallel could use them up.
+func (tp *TimesPatcher) Global() bool {
+	return true
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patcher
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimesPatcherImplementsPatcher(t *testing.T) {
+	assert.Implements(t, (*GlobalPatcher)(nil), &TimesPatcher{})
+}
+
+func TestTimesBase(t *testing.T) {
+	fn := func(x int) int { return x }
+	repl := func(x int) int { return -x }
+
+	result := Times(2, &fn, repl)
+
+	assert.Equal(t, 2, result.n)
+	assert.Equal(t, reflect.ValueOf(&fn).Elem(), result.variable)
+	assert.Equal(t, reflect.ValueOf(repl).Pointer(), result.replacement.Pointer())
+	assert.False(t, result.applied)
+}
+
+func TestTimesBadCount(t *testing.T) {
+	fn := func() {}
+
+	assert.PanicsWithValue(t, "cannot patch for 0 calls", func() {
+		Times(0, &fn, func() {})
+	})
+}
+
+func TestTimesNotPointer(t *testing.T) {
+	fn := func() {}
+
+	assert.PanicsWithValue(t, "cannot set variable passed to Times!", func() {
+		Times(1, fn, func() {})
+	})
+}
+
+func TestTimesNotFunction(t *testing.T) {
+	variable := 5
+
+	assert.PanicsWithValue(t, "cannot set variable passed to Times!", func() {
+		Times(1, &variable, 6)
+	})
+}
+
+func TestTimesBadReplacement(t *testing.T) {
+	fn := func() {}
+
+	assert.PanicsWithValue(t, "cannot assign func(int) type to variable type func()", func() {
+		Times(1, &fn, func(int) {})
+	})
+}
+
+func TestTimesNilReplacement(t *testing.T) {
+	fn := func() {}
+
+	assert.PanicsWithValue(t, "cannot assign <nil> type to variable type func()", func() {
+		Times(1, &fn, nil)
+	})
+}
+
+func TestTimesPatcherCalls(t *testing.T) {
+	fn := func(x int) int { return x }
+	obj := Times(2, &fn, func(x int) int { return -x })
+
+	obj.Install()
+
+	assert.Equal(t, -1, fn(1))
+	assert.Equal(t, -2, fn(2))
+	assert.Equal(t, 3, fn(3))
+	assert.True(t, obj.applied)
+	assert.Equal(t, 2, obj.Calls())
+}
+
+func TestTimesPatcherStaleCopy(t *testing.T) {
+	fn := func(x int) int { return x }
+	obj := Times(1, &fn, func(x int) int { return -x })
+	obj.Install()
+	patched := fn
+
+	assert.Equal(t, -1, patched(1))
+	assert.Equal(t, 2, patched(2))
+	assert.Equal(t, 3, fn(3))
+	assert.Equal(t, 1, obj.Calls())
+}
+
+func TestTimesPatcherVariadic(t *testing.T) {
+	fn := func(xs ...int) int { return len(xs) }
+	obj := Times(1, &fn, func(xs ...int) int { return -len(xs) })
+	obj.Install()
+
+	assert.Equal(t, -2, fn(1, 2))
+	assert.Equal(t, 3, fn(1, 2, 3))
+}
+
+func TestTimesPatcherInstall(t *testing.T) {
+	fn := func(x int) int { return x }
+	obj := Times(2, &fn, func(x int) int { return -x })
+
+	result := obj.Install()
+
+	assert.Same(t, obj, result)
+	assert.True(t, obj.applied)
+	assert.Equal(t, 0, obj.Calls())
+	assert.Equal(t, -1, fn(1))
+}
+
+func TestTimesPatcherInstallIdempotent(t *testing.T) {
+	fn := func(x int) int { return x }
+	obj := Times(2, &fn, func(x int) int { return -x })
+	obj.Install()
+	fn(1)
+
+	result := obj.Install()
+
+	assert.Same(t, obj, result)
+	assert.Equal(t, 1, obj.Calls())
+	assert.Equal(t, -2, fn(2))
+	assert.Equal(t, 3, fn(3))
+}
+
+func TestTimesPatcherInstallAgain(t *testing.T) {
+	fn := func(x int) int { return x }
+	obj := Times(1, &fn, func(x int) int { return -x })
+	obj.Install()
+	fn(1)
+	obj.Restore()
+
+	obj.Install()
+
+	assert.Equal(t, 0, obj.Calls())
+	assert.Equal(t, -2, fn(2))
+	assert.Equal(t, 3, fn(3))
+}
+
+func TestTimesPatcherRestore(t *testing.T) {
+	fn := func(x int) int { return x }
+	obj := Times(2, &fn, func(x int) int { return -x })
+	obj.Install()
+	patched := fn
+
+	result := obj.Restore()
+
+	assert.Same(t, obj, result)
+	assert.False(t, obj.applied)
+	assert.Equal(t, 1, fn(1))
+	assert.Equal(t, 2, patched(2))
+	assert.Equal(t, 0, obj.Calls())
+}
+
+func TestTimesPatcherRestoreExhausted(t *testing.T) {
+	fn := func(x int) int { return x }
+	obj := Times(1, &fn, func(x int) int { return -x })
+	obj.Install()
+	patched := fn
+	fn(1)
+
+	result := obj.Restore()
+
+	assert.Same(t, obj, result)
+	assert.False(t, obj.applied)
+	assert.Equal(t, 2, fn(2))
+	assert.Equal(t, 3, patched(3))
+}
+
+func TestTimesPatcherRestoreIdempotent(t *testing.T) {
+	fn := func(x int) int { return x }
+	obj := Times(1, &fn, func(x int) int { return -x })
+	obj.Install()
+	obj.Restore()
+	other := func(x int) int { return x * 10 }
+	fn = other
+
+	result := obj.Restore()
+
+	assert.Same(t, obj, result)
+	assert.Equal(t, 20, fn(2))
+}
+
+func TestTimesPatcherGlobal(t *testing.T) {
+	fn := func() {}
+
+	assert.True(t, Times(1, &fn, func() {}).Global())
+}
+
+func TestTimesPatcherConcurrent(t *testing.T) {
+	fn := func() {}
+
+	hammer(Times(1, &fn, func() {}))
+
+	assert.NotPanics(t, fn)
+}
+
+func TestTimesPatcherConcurrentCalls(t *testing.T) {
+	var original, replaced int32
+	fn := func() { atomic.AddInt32(&original, 1) }
+	obj := Times(10, &fn, func() { atomic.AddInt32(&replaced, 1) })
+	obj.Install()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				fn()
+			}
+		}()
+	}
+	wg.Wait()
+	obj.Restore()
+
+	assert.Equal(t, int32(10), replaced)
+	assert.Equal(t, int32(90), original)
+	assert.Equal(t, 10, obj.Calls())
+	assert.False(t, obj.applied)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Command patcher contains tools for adopting the patcher package.
+// The "rewrite" subcommand turns direct calls to a function into
+// calls through a patch point variable:
+//
+//	patcher rewrite -func os.ReadFile ./pkg/...
+//
+// Only the non-test files of the packages are rewritten.  With the
+// -n flag, a diff of the changes is printed instead.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/klmitch/patcher/tools/rewrite"
+)
+
+// Errors that may be reported by the patcher command.
+var (
+	errUsage = errors.New("usage error")
+	errLoad  = errors.New("unable to load packages")
+)
+
+// Patch points for testing the routines in this file.
+var (
+	readFile  = os.ReadFile
+	writeFile = os.WriteFile
+)
+
+func main() {
+	if err := run("", os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "patcher: %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command with the specified arguments.  Packages are
+// interpreted relative to the specified directory.
+func run(dir string, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 || args[0] != "rewrite" {
+		fmt.Fprintf(stderr, "Usage: patcher rewrite [flags] [packages]\n")
+		return errUsage
+	}
+
+	flags := flag.NewFlagSet("patcher rewrite", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	fn := flags.String("func", "", "function to rewrite calls to, e.g., \"os.ReadFile\"")
+	name := flags.String("name", "", "name of the patch point variable; derived from -func by default")
+	dryRun := flags.Bool("n", false, "print a diff of the changes instead of writing them")
+	if err := flags.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	r, err := rewrite.New(*fn, *name)
+	if err != nil {
+		return err
+	}
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	pkgs, err := packages.Load(&packages.Config{Mode: rewrite.LoadMode, Dir: dir}, patterns...)
+	if err != nil {
+		return err
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return errLoad
+	}
+
+	for _, pkg := range pkgs {
+		files, err := r.Package(pkg, readFile)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(files))
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if *dryRun {
+				old, err := readFile(name)
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(stdout, rewrite.Diff(name, old, files[name]))
+			} else if err := writeFile(name, files[name], 0o666); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
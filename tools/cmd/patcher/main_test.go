@@ -0,0 +1,129 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/klmitch/patcher/tools/rewrite"
+)
+
+const loadSrc = `package pkg
+
+import "os"
+
+func Load(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+`
+
+const loadRewritten = `package pkg
+
+import "os"
+
+// osReadFile is a patch point for os.ReadFile.
+var osReadFile = os.ReadFile
+
+func Load(name string) ([]byte, error) {
+	return osReadFile(name)
+}
+`
+
+func writeModule(t *testing.T, src string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/pkg\n\ngo 1.22\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "load.go"), []byte(src), 0o600))
+
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeModule(t, loadSrc)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	err := run(dir, []string{"rewrite", "-func", "os.ReadFile"}, stdout, stderr)
+
+	require.NoError(t, err)
+	assert.Equal(t, "", stdout.String())
+	assert.Equal(t, "", stderr.String())
+	data, err := os.ReadFile(filepath.Join(dir, "load.go"))
+	require.NoError(t, err)
+	assert.Equal(t, loadRewritten, string(data))
+}
+
+func TestRunDryRun(t *testing.T) {
+	dir := writeModule(t, loadSrc)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	err := run(dir, []string{"rewrite", "-n", "-func", "os.ReadFile", "./..."}, stdout, stderr)
+
+	require.NoError(t, err)
+	name := filepath.Join(dir, "load.go")
+	assert.Equal(t, rewrite.Diff(name, []byte(loadSrc), []byte(loadRewritten)), stdout.String())
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, loadSrc, string(data))
+}
+
+func TestRunNoSubcommand(t *testing.T) {
+	stderr := &bytes.Buffer{}
+
+	err := run("", []string{}, &bytes.Buffer{}, stderr)
+
+	assert.ErrorIs(t, err, errUsage)
+	assert.Contains(t, stderr.String(), "Usage: patcher rewrite")
+}
+
+func TestRunBadFlag(t *testing.T) {
+	err := run("", []string{"rewrite", "-bogus"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.ErrorIs(t, err, errUsage)
+}
+
+func TestRunBadFunc(t *testing.T) {
+	err := run("", []string{"rewrite", "-func", "ReadFile"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.ErrorIs(t, err, rewrite.ErrBadFunc)
+}
+
+func TestRunLoadFails(t *testing.T) {
+	dir := writeModule(t, "package pkg\n\nvar x int = \"string\"\n")
+
+	err := run(dir, []string{"rewrite", "-func", "os.ReadFile"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.ErrorIs(t, err, errLoad)
+}
+
+func TestRunWriteFails(t *testing.T) {
+	dir := writeModule(t, loadSrc)
+	defer func(orig func(string, []byte, os.FileMode) error) { writeFile = orig }(writeFile)
+	writeFile = func(string, []byte, os.FileMode) error {
+		return assert.AnError
+	}
+
+	err := run(dir, []string{"rewrite", "-func", "os.ReadFile"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.ErrorIs(t, err, assert.AnError)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Command patchergen generates typed patch helpers for the variables
+// of a package annotated with "//patcher:point".  It is typically
+// invoked with a "go:generate" comment:
+//
+//	//go:generate patchergen
+//
+// By default, the helpers for the package in the current directory
+// are written to "patcher_points_test.go" in the package directory,
+// so that they are only available to the package's tests.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/klmitch/patcher/tools/patchergen"
+)
+
+// Errors that may be reported by patchergen.
+var (
+	errLoad    = errors.New("unable to load packages")
+	errNoFiles = errors.New("package has no files")
+)
+
+func main() {
+	output := flag.String("o", "patcher_points_test.go", "name of the file to generate in each package directory")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-o file] [packages]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run("", *output, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "patchergen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the helpers for the specified packages, which are
+// interpreted relative to the specified directory.
+func run(dir, output string, patterns []string) error {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: patchergen.LoadMode | packages.NeedFiles,
+		Dir:  dir,
+	}, patterns...)
+	if err != nil {
+		return err
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return errLoad
+	}
+
+	for _, pkg := range pkgs {
+		src, err := patchergen.Generate(pkg)
+		if err != nil {
+			return err
+		}
+		if len(pkg.GoFiles) == 0 {
+			return fmt.Errorf("%w: %s", errNoFiles, pkg.PkgPath)
+		}
+
+		if err := os.WriteFile(filepath.Join(filepath.Dir(pkg.GoFiles[0]), output), src, 0o666); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
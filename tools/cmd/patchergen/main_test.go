@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/klmitch/patcher/tools/patchergen"
+)
+
+func writeModule(t *testing.T, src string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/points\n\ngo 1.22\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "points.go"), []byte(src), 0o600))
+
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeModule(t, "package points\n\nimport \"os\"\n\n//patcher:point\nvar getenv = os.Getenv\n")
+
+	err := run(dir, "gen_test.go", nil)
+
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "gen_test.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "func PatchGetenv(")
+}
+
+func TestRunNoPoints(t *testing.T) {
+	dir := writeModule(t, "package points\n")
+
+	err := run(dir, "gen_test.go", []string{"."})
+
+	assert.ErrorIs(t, err, patchergen.ErrNoPoints)
+}
+
+func TestRunLoadFails(t *testing.T) {
+	dir := writeModule(t, "package points\n\nvar x int = \"string\"\n")
+
+	err := run(dir, "gen_test.go", []string{"."})
+
+	assert.ErrorIs(t, err, errLoad)
+}
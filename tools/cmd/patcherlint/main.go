@@ -0,0 +1,29 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Command patcherlint reports misuse of the patcher package.  It may
+// be run directly on packages, or used with "go vet":
+//
+//	go vet -vettool=$(which patcherlint) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/klmitch/patcher/tools/patcherlint"
+)
+
+func main() {
+	singlechecker.Main(patcherlint.Analyzer)
+}
@@ -0,0 +1,437 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package patchergen generates typed patch helpers for the patch
+// points of a package.  A patch point is a package-level variable
+// annotated with a "//patcher:point" comment:
+//
+//	//patcher:point
+//	var readFile = os.ReadFile
+//
+// The comment may be followed by a name to use in place of the
+// variable name when naming the helpers.  For each patch point, a
+// Patch helper is generated that returns a patcher setting the
+// variable; for function-typed patch points, Stub and Spy helpers are
+// also generated.  A PatchPoints variable listing all the patch
+// points of the package is generated as well, along with an init
+// function registering them with patcher.Register.
+package patchergen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Directive is the comment that marks a patch point.
+const Directive = "//patcher:point"
+
+// PatcherPath is the import path of the patcher package.
+const PatcherPath = "github.com/klmitch/patcher"
+
+// ErrNoPoints is returned by Generate if the package contains no
+// patch points.
+var ErrNoPoints = errors.New("no patch points found")
+
+// LoadMode is the mode needed when loading packages for Generate.
+const LoadMode = packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo
+
+// Point describes a patch point found in a package.
+type Point struct {
+	Var  *types.Var // The variable
+	Name string     // The exported name used for the helpers
+}
+
+// Find finds the patch points in a package, sorted by name.
+func Find(pkg *packages.Package) ([]Point, error) {
+	points := []Point{}
+	seen := map[string]bool{}
+
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				vspec, ok := spec.(*ast.ValueSpec)
+				if !ok {
+					continue
+				}
+
+				// Look for the directive on the spec, or on
+				// the declaration if it has only one spec
+				name, found := directive(vspec.Doc)
+				if !found && len(gen.Specs) == 1 {
+					name, found = directive(gen.Doc)
+				}
+				if !found {
+					continue
+				}
+				if name != "" && len(vspec.Names) != 1 {
+					return nil, fmt.Errorf("%s: a patch point name may only be given for a single variable", pkg.Fset.Position(vspec.Pos()))
+				}
+
+				for _, id := range vspec.Names {
+					v, ok := pkg.TypesInfo.Defs[id].(*types.Var)
+					if !ok || id.Name == "_" {
+						continue
+					}
+
+					pointName := name
+					if pointName == "" {
+						pointName = exportName(id.Name)
+					}
+					if seen[pointName] {
+						return nil, fmt.Errorf("%s: duplicate patch point name %q", pkg.Fset.Position(id.Pos()), pointName)
+					}
+					seen[pointName] = true
+
+					points = append(points, Point{Var: v, Name: pointName})
+				}
+			}
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Name < points[j].Name
+	})
+
+	return points, nil
+}
+
+// directive looks for the patch point directive in a comment group.
+// It returns the name given to the directive, if any, and a boolean
+// indicating whether the directive was found.
+func directive(doc *ast.CommentGroup) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+
+	for _, c := range doc.List {
+		if c.Text == Directive {
+			return "", true
+		}
+		if strings.HasPrefix(c.Text, Directive+" ") {
+			return exportName(strings.TrimSpace(strings.TrimPrefix(c.Text, Directive))), true
+		}
+	}
+
+	return "", false
+}
+
+// exportName converts a name to an exported name.
+func exportName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// imports tracks the packages imported by the generated code.
+type imports struct {
+	pkg    *types.Package
+	byPath map[string]string
+	byName map[string]string
+}
+
+// newImports constructs an imports for a package.
+func newImports(pkg *types.Package) *imports {
+	return &imports{
+		pkg:    pkg,
+		byPath: map[string]string{},
+		byName: map[string]string{},
+	}
+}
+
+// add adds an import, returning the name to use for it.
+func (imp *imports) add(path, name string) string {
+	if existing, ok := imp.byPath[path]; ok {
+		return existing
+	}
+
+	// Pick a name that does not collide
+	candidate := name
+	for i := 2; imp.byName[candidate] != "" || (imp.pkg.Scope().Lookup(candidate) != nil); i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	imp.byPath[path] = candidate
+	imp.byName[candidate] = path
+
+	return candidate
+}
+
+// qualifier is a types.Qualifier that records the packages used.
+func (imp *imports) qualifier(pkg *types.Package) string {
+	if pkg == imp.pkg {
+		return ""
+	}
+
+	return imp.add(pkg.Path(), pkg.Name())
+}
+
+// typeString formats a type for the generated code.
+func (imp *imports) typeString(typ types.Type) string {
+	return types.TypeString(typ, imp.qualifier)
+}
+
+// write emits the import block.
+func (imp *imports) write(buf *bytes.Buffer) {
+	paths := make([]string, 0, len(imp.byPath))
+	for path := range imp.byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// Standard library packages go in their own group
+	groups := [2][]string{}
+	for _, path := range paths {
+		line := strconv.Quote(path)
+		if name := imp.byPath[path]; name != path[strings.LastIndex(path, "/")+1:] {
+			line = name + " " + line
+		}
+
+		if isStd(path) {
+			groups[0] = append(groups[0], "\t"+line+"\n")
+		} else {
+			groups[1] = append(groups[1], "\t"+line+"\n")
+		}
+	}
+
+	buf.WriteString("import (\n")
+	buf.WriteString(strings.Join(groups[0], ""))
+	if len(groups[0]) > 0 && len(groups[1]) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString(strings.Join(groups[1], ""))
+	buf.WriteString(")\n\n")
+}
+
+// isStd tests whether an import path is for a standard library
+// package.
+func isStd(path string) bool {
+	first := path
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		first = path[:i]
+	}
+
+	return !strings.Contains(first, ".")
+}
+
+// Generate generates the patch helpers for the patch points of a
+// package, which must have been loaded with at least LoadMode.  The
+// generated source is formatted.
+func Generate(pkg *packages.Package) ([]byte, error) {
+	points, err := Find(pkg)
+	if err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("package %s: %w", pkg.PkgPath, ErrNoPoints)
+	}
+
+	// Generate the body first so that the imports are known
+	imp := newImports(pkg.Types)
+	body := &bytes.Buffer{}
+	for _, point := range points {
+		genPatch(body, imp, point)
+		if sig, ok := point.Var.Type().Underlying().(*types.Signature); ok {
+			genStub(body, imp, point, sig)
+			genSpy(body, imp, point, sig)
+		}
+	}
+	genRegistry(body, imp, pkg.Types.Name(), points)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("// Code generated by patchergen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", pkg.Types.Name())
+	imp.write(buf)
+	buf.Write(body.Bytes())
+
+	return format.Source(buf.Bytes())
+}
+
+// genPatch generates the Patch helper for a patch point.
+func genPatch(buf *bytes.Buffer, imp *imports, point Point) {
+	fmt.Fprintf(buf, "// Patch%s returns a patcher that sets %s to the specified value.\n", point.Name, point.Var.Name())
+	pkg := imp.add(PatcherPath, "patcher")
+	fmt.Fprintf(buf, "func Patch%s(value %s) *%s.VariableSetter {\n", point.Name, imp.typeString(point.Var.Type()), pkg)
+	fmt.Fprintf(buf, "\treturn %s.SetVar(&%s, value)\n", pkg, point.Var.Name())
+	buf.WriteString("}\n\n")
+}
+
+// signature describes the parameters and results of a function type
+// in the form needed to generate the helpers.
+type signature struct {
+	params     []string // Parameter declarations, e.g., "a0 string"
+	args       []string // Arguments for calling the function
+	paramTypes []string // Field types for recording the parameters
+	results    []string // Result types
+	resultVars []string // Result variable names
+}
+
+// describe describes a function signature.
+func describe(imp *imports, sig *types.Signature) signature {
+	desc := signature{}
+
+	for i := 0; i < sig.Params().Len(); i++ {
+		name := fmt.Sprintf("a%d", i)
+		typ := sig.Params().At(i).Type()
+		desc.paramTypes = append(desc.paramTypes, imp.typeString(typ))
+
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			elem := typ.(*types.Slice).Elem()
+			desc.params = append(desc.params, fmt.Sprintf("%s ...%s", name, imp.typeString(elem)))
+			desc.args = append(desc.args, name+"...")
+		} else {
+			desc.params = append(desc.params, fmt.Sprintf("%s %s", name, imp.typeString(typ)))
+			desc.args = append(desc.args, name)
+		}
+	}
+
+	for i := 0; i < sig.Results().Len(); i++ {
+		desc.results = append(desc.results, imp.typeString(sig.Results().At(i).Type()))
+		desc.resultVars = append(desc.resultVars, fmt.Sprintf("r%d", i))
+	}
+
+	return desc
+}
+
+// funcType formats the parameter and result lists of a function
+// literal.
+func (desc signature) funcType() string {
+	result := "(" + strings.Join(desc.params, ", ") + ")"
+	switch len(desc.results) {
+	case 0:
+	case 1:
+		result += " " + desc.results[0]
+	default:
+		result += " (" + strings.Join(desc.results, ", ") + ")"
+	}
+
+	return result
+}
+
+// genStub generates the Stub helper for a function patch point.
+func genStub(buf *bytes.Buffer, imp *imports, point Point, sig *types.Signature) {
+	desc := describe(imp, sig)
+	pkg := imp.add(PatcherPath, "patcher")
+
+	decls := make([]string, len(desc.results))
+	for i, typ := range desc.results {
+		decls[i] = fmt.Sprintf("%s %s", desc.resultVars[i], typ)
+	}
+
+	fmt.Fprintf(buf, "// Stub%s returns a patcher that replaces %s with a function\n", point.Name, point.Var.Name())
+	if len(desc.results) > 0 {
+		buf.WriteString("// that returns the specified values.\n")
+	} else {
+		buf.WriteString("// that does nothing.\n")
+	}
+	fmt.Fprintf(buf, "func Stub%s(%s) *%s.VariableSetter {\n", point.Name, strings.Join(decls, ", "), pkg)
+	fmt.Fprintf(buf, "\treturn %s.SetVar(&%s, func%s {\n", pkg, point.Var.Name(), desc.funcType())
+	if len(desc.results) > 0 {
+		fmt.Fprintf(buf, "\t\treturn %s\n", strings.Join(desc.resultVars, ", "))
+	}
+	buf.WriteString("\t})\n}\n\n")
+}
+
+// genSpy generates the Spy helper and its types for a function patch
+// point.
+func genSpy(buf *bytes.Buffer, imp *imports, point Point, sig *types.Signature) {
+	desc := describe(imp, sig)
+	pkg := imp.add(PatcherPath, "patcher")
+	syncPkg := imp.add("sync", "sync")
+	callType := point.Name + "Call"
+	spyType := point.Name + "Spy"
+
+	// The call record
+	fmt.Fprintf(buf, "// %s records the arguments and results of a call to %s.\n", callType, point.Var.Name())
+	fields := []string{}
+	decls := []string{}
+	for i, typ := range desc.paramTypes {
+		decls = append(decls, fmt.Sprintf("\tA%d %s\n", i, typ))
+		fields = append(fields, fmt.Sprintf("A%d: a%d", i, i))
+	}
+	for i, typ := range desc.results {
+		decls = append(decls, fmt.Sprintf("\tR%d %s\n", i, typ))
+		fields = append(fields, fmt.Sprintf("R%d: r%d", i, i))
+	}
+	if len(decls) == 0 {
+		fmt.Fprintf(buf, "type %s struct{}\n\n", callType)
+	} else {
+		fmt.Fprintf(buf, "type %s struct {\n%s}\n\n", callType, strings.Join(decls, ""))
+	}
+
+	// The spy
+	fmt.Fprintf(buf, "// %s records the calls to %s.\n", spyType, point.Var.Name())
+	fmt.Fprintf(buf, "type %s struct {\n\tlock  %s.Mutex\n\tcalls []%s\n}\n\n", spyType, syncPkg, callType)
+	buf.WriteString("// Calls returns the calls recorded by the spy.\n")
+	fmt.Fprintf(buf, "func (s *%s) Calls() []%s {\n", spyType, callType)
+	buf.WriteString("\ts.lock.Lock()\n\tdefer s.lock.Unlock()\n\n")
+	fmt.Fprintf(buf, "\treturn append([]%s(nil), s.calls...)\n}\n\n", callType)
+
+	// The spy constructor
+	fmt.Fprintf(buf, "// Spy%s returns a patcher that replaces %s with a function that\n", point.Name, point.Var.Name())
+	fmt.Fprintf(buf, "// calls the value %s had when Spy%s was called, recording the\n", point.Var.Name(), point.Name)
+	buf.WriteString("// calls in the returned spy.\n")
+	fmt.Fprintf(buf, "func Spy%s() (*%s.VariableSetter, *%s) {\n", point.Name, pkg, spyType)
+	fmt.Fprintf(buf, "\tspy := &%s{}\n\torig := %s\n\n", spyType, point.Var.Name())
+	fmt.Fprintf(buf, "\treturn %s.SetVar(&%s, func%s {\n", pkg, point.Var.Name(), desc.funcType())
+	call := fmt.Sprintf("orig(%s)", strings.Join(desc.args, ", "))
+	if len(desc.results) > 0 {
+		fmt.Fprintf(buf, "\t\t%s := %s\n", strings.Join(desc.resultVars, ", "), call)
+	} else {
+		fmt.Fprintf(buf, "\t\t%s\n", call)
+	}
+	buf.WriteString("\t\tspy.lock.Lock()\n")
+	fmt.Fprintf(buf, "\t\tspy.calls = append(spy.calls, %s{%s})\n", callType, strings.Join(fields, ", "))
+	buf.WriteString("\t\tspy.lock.Unlock()\n")
+	if len(desc.results) > 0 {
+		fmt.Fprintf(buf, "\n\t\treturn %s\n", strings.Join(desc.resultVars, ", "))
+	}
+	buf.WriteString("\t}), spy\n}\n\n")
+}
+
+// genRegistry generates the list of patch points and an init
+// function registering them.  The points are registered under the
+// package name and variable name, as in "storage.readFile", and their
+// types are computed using reflect so that they match those reported
+// by patcher.Points.
+func genRegistry(buf *bytes.Buffer, imp *imports, pkgName string, points []Point) {
+	pkg := imp.add(PatcherPath, "patcher")
+	reflectPkg := imp.add("reflect", "reflect")
+
+	buf.WriteString("// PatchPoints lists the patch points of the package.\n")
+	fmt.Fprintf(buf, "var PatchPoints = []%s.PatchPoint{\n", pkg)
+	for _, point := range points {
+		fmt.Fprintf(buf, "\t{Name: %s, Type: %s.TypeOf(&%s).Elem().String(), Variable: &%s},\n",
+			strconv.Quote(pkgName+"."+point.Var.Name()), reflectPkg, point.Var.Name(), point.Var.Name())
+	}
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("func init() {\n")
+	buf.WriteString("\tfor _, point := range PatchPoints {\n")
+	fmt.Fprintf(buf, "\t\t%s.Register(point.Name, point.Variable)\n", pkg)
+	buf.WriteString("\t}\n}\n")
+}
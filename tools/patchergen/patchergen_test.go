@@ -0,0 +1,103 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package patchergen
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func load(t *testing.T, dir string) *packages.Package {
+	t.Helper()
+
+	pkgs, err := packages.Load(&packages.Config{Mode: LoadMode, Dir: dir}, ".")
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	require.Empty(t, pkgs[0].Errors)
+
+	return pkgs[0]
+}
+
+func TestFind(t *testing.T) {
+	pkg := load(t, filepath.Join("testdata", "points"))
+
+	result, err := Find(pkg)
+
+	require.NoError(t, err)
+	names := []string{}
+	for _, point := range result {
+		names = append(names, point.Name+"="+point.Var.Name())
+	}
+	assert.Equal(t, []string{
+		"Getenv=getenv",
+		"Handle=handle",
+		"Logger=logf",
+		"Once=once",
+		"ReadFile=readFile",
+		"Reset=reset",
+		"Timeout=timeout",
+	}, names)
+}
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("testdata", "points")
+	golden := filepath.Join(dir, "patcher_points_test.go")
+	pkg := load(t, dir)
+
+	result, err := Generate(pkg)
+
+	require.NoError(t, err)
+	if *update {
+		require.NoError(t, os.WriteFile(golden, result, 0o600))
+	}
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(result))
+}
+
+func TestGenerateNoPoints(t *testing.T) {
+	pkg := load(t, filepath.Join("testdata", "nopoints"))
+
+	result, err := Generate(pkg)
+
+	assert.ErrorIs(t, err, ErrNoPoints)
+	assert.Nil(t, result)
+}
+
+func TestGenerateDuplicate(t *testing.T) {
+	pkg := load(t, filepath.Join("testdata", "duplicate"))
+
+	result, err := Generate(pkg)
+
+	assert.ErrorContains(t, err, `duplicate patch point name "ReadFile"`)
+	assert.Nil(t, result)
+}
+
+func TestGenerateNamedMultiple(t *testing.T) {
+	pkg := load(t, filepath.Join("testdata", "multiple"))
+
+	result, err := Generate(pkg)
+
+	assert.ErrorContains(t, err, "a patch point name may only be given for a single variable")
+	assert.Nil(t, result)
+}
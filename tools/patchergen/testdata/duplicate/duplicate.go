@@ -0,0 +1,9 @@
+package duplicate
+
+import "os"
+
+//patcher:point
+var readFile = os.ReadFile
+
+//patcher:point ReadFile
+var otherReadFile = os.ReadFile
@@ -0,0 +1,4 @@
+package multiple
+
+//patcher:point Name
+var one, two = 1, 2
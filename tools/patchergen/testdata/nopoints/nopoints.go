@@ -0,0 +1,3 @@
+package nopoints
+
+var readFile = 5
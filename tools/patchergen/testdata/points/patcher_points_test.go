@@ -0,0 +1,280 @@
+// Code generated by patchergen. DO NOT EDIT.
+
+package points
+
+import (
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/klmitch/patcher"
+)
+
+// PatchGetenv returns a patcher that sets getenv to the specified value.
+func PatchGetenv(value func(key string) string) *patcher.VariableSetter {
+	return patcher.SetVar(&getenv, value)
+}
+
+// StubGetenv returns a patcher that replaces getenv with a function
+// that returns the specified values.
+func StubGetenv(r0 string) *patcher.VariableSetter {
+	return patcher.SetVar(&getenv, func(a0 string) string {
+		return r0
+	})
+}
+
+// GetenvCall records the arguments and results of a call to getenv.
+type GetenvCall struct {
+	A0 string
+	R0 string
+}
+
+// GetenvSpy records the calls to getenv.
+type GetenvSpy struct {
+	lock  sync.Mutex
+	calls []GetenvCall
+}
+
+// Calls returns the calls recorded by the spy.
+func (s *GetenvSpy) Calls() []GetenvCall {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]GetenvCall(nil), s.calls...)
+}
+
+// SpyGetenv returns a patcher that replaces getenv with a function that
+// calls the value getenv had when SpyGetenv was called, recording the
+// calls in the returned spy.
+func SpyGetenv() (*patcher.VariableSetter, *GetenvSpy) {
+	spy := &GetenvSpy{}
+	orig := getenv
+
+	return patcher.SetVar(&getenv, func(a0 string) string {
+		r0 := orig(a0)
+		spy.lock.Lock()
+		spy.calls = append(spy.calls, GetenvCall{A0: a0, R0: r0})
+		spy.lock.Unlock()
+
+		return r0
+	}), spy
+}
+
+// PatchHandle returns a patcher that sets handle to the specified value.
+func PatchHandle(value handler) *patcher.VariableSetter {
+	return patcher.SetVar(&handle, value)
+}
+
+// StubHandle returns a patcher that replaces handle with a function
+// that returns the specified values.
+func StubHandle(r0 error) *patcher.VariableSetter {
+	return patcher.SetVar(&handle, func(a0 io.Writer) error {
+		return r0
+	})
+}
+
+// HandleCall records the arguments and results of a call to handle.
+type HandleCall struct {
+	A0 io.Writer
+	R0 error
+}
+
+// HandleSpy records the calls to handle.
+type HandleSpy struct {
+	lock  sync.Mutex
+	calls []HandleCall
+}
+
+// Calls returns the calls recorded by the spy.
+func (s *HandleSpy) Calls() []HandleCall {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]HandleCall(nil), s.calls...)
+}
+
+// SpyHandle returns a patcher that replaces handle with a function that
+// calls the value handle had when SpyHandle was called, recording the
+// calls in the returned spy.
+func SpyHandle() (*patcher.VariableSetter, *HandleSpy) {
+	spy := &HandleSpy{}
+	orig := handle
+
+	return patcher.SetVar(&handle, func(a0 io.Writer) error {
+		r0 := orig(a0)
+		spy.lock.Lock()
+		spy.calls = append(spy.calls, HandleCall{A0: a0, R0: r0})
+		spy.lock.Unlock()
+
+		return r0
+	}), spy
+}
+
+// PatchLogger returns a patcher that sets logf to the specified value.
+func PatchLogger(value func(format string, args ...interface{})) *patcher.VariableSetter {
+	return patcher.SetVar(&logf, value)
+}
+
+// StubLogger returns a patcher that replaces logf with a function
+// that does nothing.
+func StubLogger() *patcher.VariableSetter {
+	return patcher.SetVar(&logf, func(a0 string, a1 ...interface{}) {
+	})
+}
+
+// LoggerCall records the arguments and results of a call to logf.
+type LoggerCall struct {
+	A0 string
+	A1 []interface{}
+}
+
+// LoggerSpy records the calls to logf.
+type LoggerSpy struct {
+	lock  sync.Mutex
+	calls []LoggerCall
+}
+
+// Calls returns the calls recorded by the spy.
+func (s *LoggerSpy) Calls() []LoggerCall {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]LoggerCall(nil), s.calls...)
+}
+
+// SpyLogger returns a patcher that replaces logf with a function that
+// calls the value logf had when SpyLogger was called, recording the
+// calls in the returned spy.
+func SpyLogger() (*patcher.VariableSetter, *LoggerSpy) {
+	spy := &LoggerSpy{}
+	orig := logf
+
+	return patcher.SetVar(&logf, func(a0 string, a1 ...interface{}) {
+		orig(a0, a1...)
+		spy.lock.Lock()
+		spy.calls = append(spy.calls, LoggerCall{A0: a0, A1: a1})
+		spy.lock.Unlock()
+	}), spy
+}
+
+// PatchOnce returns a patcher that sets once to the specified value.
+func PatchOnce(value *sync.Once) *patcher.VariableSetter {
+	return patcher.SetVar(&once, value)
+}
+
+// PatchReadFile returns a patcher that sets readFile to the specified value.
+func PatchReadFile(value func(name string) ([]byte, error)) *patcher.VariableSetter {
+	return patcher.SetVar(&readFile, value)
+}
+
+// StubReadFile returns a patcher that replaces readFile with a function
+// that returns the specified values.
+func StubReadFile(r0 []byte, r1 error) *patcher.VariableSetter {
+	return patcher.SetVar(&readFile, func(a0 string) ([]byte, error) {
+		return r0, r1
+	})
+}
+
+// ReadFileCall records the arguments and results of a call to readFile.
+type ReadFileCall struct {
+	A0 string
+	R0 []byte
+	R1 error
+}
+
+// ReadFileSpy records the calls to readFile.
+type ReadFileSpy struct {
+	lock  sync.Mutex
+	calls []ReadFileCall
+}
+
+// Calls returns the calls recorded by the spy.
+func (s *ReadFileSpy) Calls() []ReadFileCall {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]ReadFileCall(nil), s.calls...)
+}
+
+// SpyReadFile returns a patcher that replaces readFile with a function that
+// calls the value readFile had when SpyReadFile was called, recording the
+// calls in the returned spy.
+func SpyReadFile() (*patcher.VariableSetter, *ReadFileSpy) {
+	spy := &ReadFileSpy{}
+	orig := readFile
+
+	return patcher.SetVar(&readFile, func(a0 string) ([]byte, error) {
+		r0, r1 := orig(a0)
+		spy.lock.Lock()
+		spy.calls = append(spy.calls, ReadFileCall{A0: a0, R0: r0, R1: r1})
+		spy.lock.Unlock()
+
+		return r0, r1
+	}), spy
+}
+
+// PatchReset returns a patcher that sets reset to the specified value.
+func PatchReset(value func()) *patcher.VariableSetter {
+	return patcher.SetVar(&reset, value)
+}
+
+// StubReset returns a patcher that replaces reset with a function
+// that does nothing.
+func StubReset() *patcher.VariableSetter {
+	return patcher.SetVar(&reset, func() {
+	})
+}
+
+// ResetCall records the arguments and results of a call to reset.
+type ResetCall struct{}
+
+// ResetSpy records the calls to reset.
+type ResetSpy struct {
+	lock  sync.Mutex
+	calls []ResetCall
+}
+
+// Calls returns the calls recorded by the spy.
+func (s *ResetSpy) Calls() []ResetCall {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]ResetCall(nil), s.calls...)
+}
+
+// SpyReset returns a patcher that replaces reset with a function that
+// calls the value reset had when SpyReset was called, recording the
+// calls in the returned spy.
+func SpyReset() (*patcher.VariableSetter, *ResetSpy) {
+	spy := &ResetSpy{}
+	orig := reset
+
+	return patcher.SetVar(&reset, func() {
+		orig()
+		spy.lock.Lock()
+		spy.calls = append(spy.calls, ResetCall{})
+		spy.lock.Unlock()
+	}), spy
+}
+
+// PatchTimeout returns a patcher that sets timeout to the specified value.
+func PatchTimeout(value int) *patcher.VariableSetter {
+	return patcher.SetVar(&timeout, value)
+}
+
+// PatchPoints lists the patch points of the package.
+var PatchPoints = []patcher.PatchPoint{
+	{Name: "points.getenv", Type: reflect.TypeOf(&getenv).Elem().String(), Variable: &getenv},
+	{Name: "points.handle", Type: reflect.TypeOf(&handle).Elem().String(), Variable: &handle},
+	{Name: "points.logf", Type: reflect.TypeOf(&logf).Elem().String(), Variable: &logf},
+	{Name: "points.once", Type: reflect.TypeOf(&once).Elem().String(), Variable: &once},
+	{Name: "points.readFile", Type: reflect.TypeOf(&readFile).Elem().String(), Variable: &readFile},
+	{Name: "points.reset", Type: reflect.TypeOf(&reset).Elem().String(), Variable: &reset},
+	{Name: "points.timeout", Type: reflect.TypeOf(&timeout).Elem().String(), Variable: &timeout},
+}
+
+func init() {
+	for _, point := range PatchPoints {
+		patcher.Register(point.Name, point.Variable)
+	}
+}
@@ -0,0 +1,33 @@
+package points
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+type handler func(w io.Writer) error
+
+//patcher:point
+var readFile = os.ReadFile
+
+var (
+	//patcher:point
+	getenv = os.Getenv
+
+	//patcher:point logger
+	logf = func(format string, args ...interface{}) {}
+
+	notAPoint = 5
+)
+
+// timeout is the timeout.
+//
+//patcher:point
+var timeout = 30
+
+//patcher:point
+var handle handler = func(w io.Writer) error { return nil }
+
+//patcher:point
+var once, reset = &sync.Once{}, func() {}
@@ -0,0 +1,395 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package patcherlint contains an analyzer that reports misuse of the
+// patcher package that would otherwise only be detected at run time,
+// if at all.  It reports:
+//
+// - Patches installed with SetVar(...).Install(), SetEnv(...).Install(),
+// UnsetEnv(...).Install(), or the SetVarFunc and SetEnvFunc
+// equivalents that are never restored, including those installed by
+// a defer or go statement;
+//
+// - Calls to SetVar whose first argument is not a pointer to a
+// variable, or whose value cannot be assigned to the variable;
+//
+// - Patches installed with PatchMaster.Add(...).Install() where the
+// PatchMaster is not restored by a deferred call, either directly or
+// from a deferred function literal.
+//
+// The analyzer may be run with "go vet -vettool" using the
+// patcherlint command, or integrated into golangci-lint.
+package patcherlint
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// PatcherPath is the import path of the patcher package.
+const PatcherPath = "github.com/klmitch/patcher"
+
+// Analyzer is the patcherlint analyzer.
+var Analyzer = &analysis.Analyzer{
+	Name:     "patcherlint",
+	Doc:      "report misuse of the patcher package",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// constructors is the set of patcher constructors whose installed
+// patches must be restored.
+var constructors = map[string]bool{
+	"SetVar":     true,
+	"SetVarFunc": true,
+	"SetEnv":     true,
+	"SetEnvFunc": true,
+	"UnsetEnv":   true,
+}
+
+// run is the analysis function.
+func run(pass *analysis.Pass) (interface{}, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodes := []ast.Node{(*ast.FuncDecl)(nil), (*ast.FuncLit)(nil)}
+	insp.Preorder(nodes, func(n ast.Node) {
+		var body *ast.BlockStmt
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			body = fn.Body
+		case *ast.FuncLit:
+			body = fn.Body
+		}
+		if body != nil {
+			checkBody(pass, body)
+		}
+	})
+
+	return nil, nil
+}
+
+// patcherFunc returns the patcher package function or method called
+// by a call expression, or nil if the call is not to the patcher
+// package.
+func patcherFunc(pass *analysis.Pass, call *ast.CallExpr) *types.Func {
+	var id *ast.Ident
+	switch fun := astutil.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return nil
+	}
+
+	fn, ok := pass.TypesInfo.Uses[id].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != PatcherPath {
+		return nil
+	}
+
+	return fn
+}
+
+// isConstructor tests whether a call is to one of the constructors.
+func isConstructor(pass *analysis.Pass, call *ast.CallExpr) bool {
+	fn := patcherFunc(pass, call)
+	if fn == nil {
+		return false
+	}
+
+	sig, ok := fn.Type().(*types.Signature)
+	return ok && sig.Recv() == nil && constructors[fn.Name()]
+}
+
+// methodCall splits a method call into its receiver and method name.
+// It returns nil if the expression is not a method call.
+func methodCall(expr ast.Expr) (ast.Expr, string) {
+	call, ok := astutil.Unparen(expr).(*ast.CallExpr)
+	if !ok {
+		return nil, ""
+	}
+
+	sel, ok := astutil.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return nil, ""
+	}
+
+	return sel.X, sel.Sel.Name
+}
+
+// checkBody checks the body of a function.  Nested function literals
+// are checked separately.
+func checkBody(pass *analysis.Pass, body *ast.BlockStmt) {
+	// Build a stack of parents as we walk the tree
+	stack := []ast.Node{}
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		stack = append(stack, n)
+
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		if fn := patcherFunc(pass, call); fn != nil && fn.Name() == "SetVar" && isConstructor(pass, call) {
+			checkSetVar(pass, call)
+		}
+
+		recv, name := methodCall(call)
+		if name != "Install" {
+			return true
+		}
+		if fn := patcherFunc(pass, call); fn == nil {
+			return true
+		}
+
+		switch inner := astutil.Unparen(recv).(type) {
+		case *ast.CallExpr:
+			if isConstructor(pass, inner) {
+				checkRestored(pass, body, call, stack)
+			} else if addRecv, addName := methodCall(inner); addName == "Add" && isPatchMaster(pass, addRecv) {
+				checkAdd(pass, body, call, addRecv, stack)
+			}
+		}
+
+		return true
+	})
+}
+
+// checkSetVar checks the arguments to a SetVar call.
+func checkSetVar(pass *analysis.Pass, call *ast.CallExpr) {
+	if len(call.Args) != 2 {
+		return
+	}
+
+	// Values of interface or type parameter type may hold a
+	// pointer, and can only be checked at run time
+	varType := pass.TypesInfo.TypeOf(call.Args[0])
+	if varType == nil || types.IsInterface(varType) {
+		return
+	}
+	if _, ok := varType.(*types.TypeParam); ok {
+		return
+	}
+	ptr, ok := varType.Underlying().(*types.Pointer)
+	if !ok {
+		pass.Reportf(call.Args[0].Pos(), "first argument to SetVar must be a pointer to a variable, not %s", varType)
+		return
+	}
+
+	tv, ok := pass.TypesInfo.Types[call.Args[1]]
+	if !ok || tv.Type == nil {
+		return
+	}
+	if tv.IsNil() {
+		pass.Reportf(call.Args[1].Pos(), "value passed to SetVar must not be untyped nil")
+		return
+	}
+
+	// The value is passed as an interface{}, so untyped
+	// constants take on their default type; values of interface
+	// type can only be checked at run time
+	valType := types.Default(tv.Type)
+	if types.IsInterface(valType) {
+		return
+	}
+	if !types.AssignableTo(valType, ptr.Elem()) {
+		pass.Reportf(call.Args[1].Pos(), "cannot assign %s to variable of type %s in SetVar", valType, ptr.Elem())
+	}
+}
+
+// isPatchMaster tests whether an expression is a *PatchMaster.
+func isPatchMaster(pass *analysis.Pass, expr ast.Expr) bool {
+	typ := pass.TypesInfo.TypeOf(expr)
+	if typ == nil {
+		return false
+	}
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+
+	named, ok := typ.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == PatcherPath && named.Obj().Name() == "PatchMaster"
+}
+
+// chainedRestore tests whether the Install call at the top of the
+// stack is immediately followed by a call to Restore.
+func chainedRestore(stack []ast.Node) bool {
+	if len(stack) < 3 {
+		return false
+	}
+
+	sel, ok := stack[len(stack)-2].(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Restore" {
+		return false
+	}
+	_, ok = stack[len(stack)-3].(*ast.CallExpr)
+
+	return ok
+}
+
+// checkRestored checks that a patch installed with
+// Constructor(...).Install() is restored.
+func checkRestored(pass *analysis.Pass, body *ast.BlockStmt, call *ast.CallExpr, stack []ast.Node) {
+	if chainedRestore(stack) {
+		return
+	}
+
+	switch parent := stack[len(stack)-2].(type) {
+	case *ast.ExprStmt, *ast.DeferStmt, *ast.GoStmt:
+		pass.Reportf(call.Pos(), "patch installed here is never restored; use \"defer ....Install().Restore()\"")
+
+	case *ast.AssignStmt:
+		// Find the variable the result is assigned to
+		for i, rhs := range parent.Rhs {
+			if rhs != ast.Expr(call) || i >= len(parent.Lhs) {
+				continue
+			}
+			id, ok := parent.Lhs[i].(*ast.Ident)
+			if !ok {
+				return
+			}
+			if id.Name == "_" {
+				pass.Reportf(call.Pos(), "patch installed here is never restored; use \"defer ....Install().Restore()\"")
+				return
+			}
+			if obj := pass.TypesInfo.ObjectOf(id); obj != nil && !restoresObject(pass, body, obj) {
+				pass.Reportf(call.Pos(), "patch installed here is never restored; call Restore on %s", id.Name)
+			}
+		}
+	}
+}
+
+// restoresObject tests whether the body contains a call to the
+// Restore method of the specified object.
+func restoresObject(pass *analysis.Pass, body *ast.BlockStmt, obj types.Object) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		recv, name := methodCall(exprOf(n))
+		if name != "Restore" {
+			return true
+		}
+		if id, ok := astutil.Unparen(recv).(*ast.Ident); ok && pass.TypesInfo.ObjectOf(id) == obj {
+			found = true
+		}
+
+		return true
+	})
+
+	return found
+}
+
+// exprOf returns the node as an expression, or nil.
+func exprOf(n ast.Node) ast.Expr {
+	expr, _ := n.(ast.Expr)
+	return expr
+}
+
+// rootObject returns the object of the identifier at the root of a
+// receiver chain such as pm.Install(), or nil.
+func rootObject(pass *analysis.Pass, expr ast.Expr) types.Object {
+	for {
+		switch e := astutil.Unparen(expr).(type) {
+		case *ast.Ident:
+			return pass.TypesInfo.ObjectOf(e)
+		case *ast.CallExpr:
+			recv, _ := methodCall(e)
+			if recv == nil {
+				return nil
+			}
+			expr = recv
+		default:
+			return nil
+		}
+	}
+}
+
+// isRestore tests whether an expression is a call to the Restore
+// method of the specified object.
+func isRestore(pass *analysis.Pass, expr ast.Expr, obj types.Object) bool {
+	_, name := methodCall(expr)
+
+	return name == "Restore" && rootObject(pass, expr) == obj
+}
+
+// callsRestore tests whether a function body, such as that of a
+// deferred function literal, calls the Restore method of the
+// specified object.
+func callsRestore(pass *analysis.Pass, body *ast.BlockStmt, obj types.Object) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		if expr, ok := n.(ast.Expr); ok && isRestore(pass, expr, obj) {
+			found = true
+		}
+
+		return true
+	})
+
+	return found
+}
+
+// checkAdd checks that a patch installed with pm.Add(...).Install()
+// is covered by a deferred call to the PatchMaster's Restore method.
+func checkAdd(pass *analysis.Pass, body *ast.BlockStmt, call *ast.CallExpr, pm ast.Expr, stack []ast.Node) {
+	if chainedRestore(stack) {
+		return
+	}
+
+	obj := rootObject(pass, pm)
+	if obj == nil {
+		return
+	}
+
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		deferStmt, ok := n.(*ast.DeferStmt)
+		if !ok {
+			return true
+		}
+		if lit, ok := astutil.Unparen(deferStmt.Call.Fun).(*ast.FuncLit); ok {
+			found = callsRestore(pass, lit.Body, obj)
+		} else {
+			found = isRestore(pass, deferStmt.Call, obj)
+		}
+
+		return true
+	})
+
+	if !found {
+		pass.Reportf(call.Pos(), "patch added to %s is installed, but %s is not restored by a deferred call", obj.Name(), obj.Name())
+	}
+}
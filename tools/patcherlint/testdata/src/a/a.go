@@ -0,0 +1,119 @@
+package a
+
+import (
+	"errors"
+
+	"github.com/klmitch/patcher"
+)
+
+var (
+	str     = "string"
+	num     = 5
+	fn      = func() error { return nil }
+	errVar  error
+	anError = errors.New("error")
+)
+
+func restored() {
+	defer patcher.SetVar(&str, "value").Install().Restore()
+	defer patcher.SetEnv("NAME", "value").Install().Restore()
+	defer patcher.UnsetEnv("NAME").Install().Restore()
+	defer patcher.SetVarFunc(&str, func() string { return "value" }).Install().Restore()
+	defer patcher.SetEnvFunc("NAME", func() string { return "value" }).Install().Restore()
+
+	p := patcher.SetVar(&num, 5).Install()
+	defer p.Restore()
+
+	q := patcher.SetEnv("NAME", "value").Install()
+	q.Restore()
+}
+
+func unrestored() {
+	patcher.SetVar(&str, "value").Install()     // want `patch installed here is never restored`
+	patcher.SetEnv("NAME", "value").Install()   // want `patch installed here is never restored`
+	(patcher.UnsetEnv("NAME")).Install()        // want `patch installed here is never restored`
+	_ = patcher.SetVar(&str, "value").Install() // want `patch installed here is never restored`
+
+	patcher.SetVarFunc(&str, func() string { return "value" }).Install()   // want `patch installed here is never restored`
+	patcher.SetEnvFunc("NAME", func() string { return "value" }).Install() // want `patch installed here is never restored`
+
+	p := patcher.SetVar(&num, 5).Install() // want `patch installed here is never restored; call Restore on p`
+	_ = p
+
+	func() {
+		patcher.SetVar(&str, "value").Install() // want `patch installed here is never restored`
+	}()
+
+	defer patcher.SetVar(&str, "value").Install() // want `patch installed here is never restored`
+	go patcher.SetEnv("NAME", "value").Install()  // want `patch installed here is never restored`
+}
+
+func setVarArgs() {
+	patcher.SetVar(str, "value")                               // want `first argument to SetVar must be a pointer to a variable, not string`
+	patcher.SetVar(&str, 5)                                    // want `cannot assign int to variable of type string in SetVar`
+	patcher.SetVar(&num, 5.0)                                  // want `cannot assign float64 to variable of type int in SetVar`
+	patcher.SetVar(&fn, nil)                                   // want `value passed to SetVar must not be untyped nil`
+	patcher.SetVar(&fn, func() (int, error) { return 0, nil }) // want `cannot assign func\(\) \(int, error\) to variable of type func\(\) error in SetVar`
+	patcher.SetVar(&fn, func() error { return nil })
+	patcher.SetVar(&errVar, anError)
+	patcher.SetVar(&num, interface{}(5))
+}
+
+func setVarInterface(v interface{}) {
+	patcher.SetVar(v, "value")
+}
+
+func setVarTypeParam[T any](v T) {
+	patcher.SetVar(v, "value")
+}
+
+func setVarTypeParamPointer[T any](v *T, value T) {
+	patcher.SetVar(v, value)
+}
+
+func addDeferred() {
+	pm := patcher.NewPatchMaster()
+	defer pm.Install().Restore()
+
+	pm.Add(patcher.SetVar(&str, "value")).Install()
+}
+
+func addDeferredRestore() {
+	pm := patcher.NewPatchMaster()
+	defer pm.Restore()
+
+	pm.Add(patcher.SetVar(&str, "value")).Install()
+	pm.Add(patcher.SetVar(&str, "value")).Install().Restore()
+}
+
+func addDeferredClosure() {
+	pm := patcher.NewPatchMaster()
+	defer func() {
+		pm.Restore()
+	}()
+
+	pm.Add(patcher.SetVar(&str, "value")).Install()
+}
+
+func addDeferredClosureOther() {
+	pm := patcher.NewPatchMaster()
+	other := patcher.NewPatchMaster()
+	defer func() {
+		other.Restore()
+	}()
+
+	pm.Add(patcher.SetVar(&str, "value")).Install() // want `patch added to pm is installed, but pm is not restored by a deferred call`
+}
+
+func addNotDeferred() {
+	pm := patcher.NewPatchMaster()
+	pm.Install()
+
+	pm.Add(patcher.SetVar(&str, "value")).Install() // want `patch added to pm is installed, but pm is not restored by a deferred call`
+
+	pm.Restore()
+}
+
+func addOther(pms []*patcher.PatchMaster) {
+	pms[0].Add(patcher.SetVar(&str, "value")).Install()
+}
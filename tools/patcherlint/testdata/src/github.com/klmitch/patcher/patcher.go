@@ -0,0 +1,35 @@
+package patcher
+
+type Patcher interface {
+	Install() Patcher
+	Restore() Patcher
+}
+
+type VariableSetter struct{}
+
+func (vs *VariableSetter) Install() Patcher { return vs }
+func (vs *VariableSetter) Restore() Patcher { return vs }
+
+type EnvPatcher struct{}
+
+func (ep *EnvPatcher) Install() Patcher { return ep }
+func (ep *EnvPatcher) Restore() Patcher { return ep }
+
+type PatchMaster struct{}
+
+func (pm *PatchMaster) Install() Patcher      { return pm }
+func (pm *PatchMaster) Restore() Patcher      { return pm }
+func (pm *PatchMaster) Add(p Patcher) Patcher { return p }
+
+func SetVar(variable, value interface{}) *VariableSetter { return &VariableSetter{} }
+func SetEnv(name, value string) *EnvPatcher              { return &EnvPatcher{} }
+func UnsetEnv(name string) *EnvPatcher                   { return &EnvPatcher{} }
+func NewPatchMaster(patches ...Patcher) *PatchMaster     { return &PatchMaster{} }
+
+func SetVarFunc[T any](variable *T, provider func() T) *VariableSetter {
+	return &VariableSetter{}
+}
+
+func SetEnvFunc(name string, provider func() string) *EnvPatcher {
+	return &EnvPatcher{}
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package rewrite turns direct calls to a function into calls through
+// a patch point.  Given a function such as os.ReadFile, it introduces
+// a package-level variable initialized to that function, once per
+// package, and rewrites each call site in the package to call the
+// variable instead:
+//
+//	// osReadFile is a patch point for os.ReadFile.
+//	var osReadFile = os.ReadFile
+//
+// Only the files passed to the rewriter are rewritten; the patcher
+// command only loads the non-test files of each package.
+package rewrite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// Errors that may be returned by the rewriter.
+var (
+	ErrBadFunc      = errors.New("function must be specified as \"import/path.Func\"")
+	ErrNameConflict = errors.New("patch point name conflicts with an existing declaration")
+)
+
+// LoadMode is the mode needed when loading packages for the
+// rewriter.
+const LoadMode = packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps |
+	packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo
+
+// Rewriter rewrites calls to a function into calls through a patch
+// point variable.
+type Rewriter struct {
+	Path string // Import path of the package containing the function
+	Func string // Name of the function
+	Name string // Name of the patch point variable
+}
+
+// New constructs a Rewriter for a function, specified by its import
+// path and name, such as "os.ReadFile" or "net/http.Get".  If the
+// name of the patch point variable is empty, it is derived from the
+// package and function names, such as "osReadFile" or "httpGet".
+func New(fn, name string) (*Rewriter, error) {
+	dot := strings.LastIndex(fn, ".")
+	if dot <= 0 || dot == len(fn)-1 || strings.LastIndex(fn, "/") > dot {
+		return nil, fmt.Errorf("%w: %q", ErrBadFunc, fn)
+	}
+
+	r := &Rewriter{
+		Path: fn[:dot],
+		Func: fn[dot+1:],
+		Name: name,
+	}
+	if r.Name == "" {
+		r.Name = r.Path[strings.LastIndex(r.Path, "/")+1:] + exportName(r.Func)
+	}
+
+	return r, nil
+}
+
+// exportName capitalizes a name.
+func exportName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// edit describes a single replacement in a file.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// fileInfo describes the rewriting of a single file.
+type fileInfo struct {
+	name    string
+	file    *ast.File
+	edits   []edit
+	pkgName *types.PkgName // the import of the function's package
+	uses    int            // the number of uses of the import
+}
+
+// target tests whether an object is the target function.
+func (r *Rewriter) target(obj types.Object) bool {
+	fn, ok := obj.(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != r.Path || fn.Name() != r.Func {
+		return false
+	}
+
+	return fn.Type().(*types.Signature).Recv() == nil
+}
+
+// Package rewrites a package, which must have been loaded with at
+// least LoadMode.  It returns the new contents of each file that
+// changed, keyed by file name.  The original contents are read with
+// readFile.
+func (r *Rewriter) Package(pkg *packages.Package, readFile func(string) ([]byte, error)) (map[string][]byte, error) {
+	// Check for an existing patch point
+	declare := true
+	if obj := pkg.Types.Scope().Lookup(r.Name); obj != nil {
+		v, ok := obj.(*types.Var)
+		if !ok || !r.initializedToTarget(pkg, v) {
+			return nil, fmt.Errorf("%w: %s in package %s", ErrNameConflict, r.Name, pkg.PkgPath)
+		}
+		declare = false
+	}
+
+	// Find the call sites in each file
+	files := []*fileInfo{}
+	for _, file := range pkg.Syntax {
+		info := r.scanFile(pkg, file)
+		if len(info.edits) > 0 {
+			files = append(files, info)
+		}
+	}
+	if len(files) == 0 {
+		return map[string][]byte{}, nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+
+	// Add the declaration to the first file
+	if declare {
+		first := files[0]
+		end := 0
+		for _, decl := range first.file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+				end = pkg.Fset.Position(gen.End()).Offset
+			}
+		}
+		first.edits = append(first.edits, edit{
+			start: end,
+			end:   end,
+			text: fmt.Sprintf("\n\n// %s is a patch point for %s.%s.\nvar %s = %s.%s",
+				r.Name, first.pkgName.Imported().Name(), r.Func, r.Name, first.pkgName.Name(), r.Func),
+		})
+		first.uses++
+	}
+
+	// Apply the edits
+	result := map[string][]byte{}
+	for _, info := range files {
+		src, err := readFile(info.name)
+		if err != nil {
+			return nil, err
+		}
+		src, err = r.apply(info, src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", info.name, err)
+		}
+		result[info.name] = src
+	}
+
+	return result, nil
+}
+
+// initializedToTarget tests whether a package-level variable is
+// initialized to the target function.
+func (r *Rewriter) initializedToTarget(pkg *packages.Package, v *types.Var) bool {
+	for _, init := range pkg.TypesInfo.InitOrder {
+		if len(init.Lhs) != 1 || init.Lhs[0] != v {
+			continue
+		}
+
+		var id *ast.Ident
+		switch rhs := astutil.Unparen(init.Rhs).(type) {
+		case *ast.SelectorExpr:
+			id = rhs.Sel
+		case *ast.Ident:
+			id = rhs
+		}
+
+		return id != nil && r.target(pkg.TypesInfo.Uses[id])
+	}
+
+	return false
+}
+
+// scanFile finds the call sites in a file.
+func (r *Rewriter) scanFile(pkg *packages.Package, file *ast.File) *fileInfo {
+	info := &fileInfo{
+		name: pkg.Fset.File(file.Pos()).Name(),
+		file: file,
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.Ident:
+			// Count the uses of the import
+			if pkgName, ok := pkg.TypesInfo.Uses[node].(*types.PkgName); ok && pkgName.Imported().Path() == r.Path {
+				info.pkgName = pkgName
+				info.uses++
+			}
+
+		case *ast.CallExpr:
+			sel, ok := astutil.Unparen(node.Fun).(*ast.SelectorExpr)
+			if !ok || !r.target(pkg.TypesInfo.Uses[sel.Sel]) {
+				return true
+			}
+			if _, ok := sel.X.(*ast.Ident); !ok {
+				return true
+			}
+
+			info.edits = append(info.edits, edit{
+				start: pkg.Fset.Position(sel.Pos()).Offset,
+				end:   pkg.Fset.Position(sel.End()).Offset,
+				text:  r.Name,
+			})
+			info.uses--
+		}
+
+		return true
+	})
+
+	return info
+}
+
+// apply applies the edits to the source of a file, removing the
+// import of the function's package if it is no longer used, and
+// formats the result.
+func (r *Rewriter) apply(info *fileInfo, src []byte) ([]byte, error) {
+	sort.Slice(info.edits, func(i, j int) bool {
+		return info.edits[i].start > info.edits[j].start
+	})
+	for _, e := range info.edits {
+		src = append(src[:e.start:e.start], append([]byte(e.text), src[e.end:]...)...)
+	}
+
+	if info.uses <= 0 {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, info.name, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		name := ""
+		if info.pkgName.Name() != info.pkgName.Imported().Name() {
+			name = info.pkgName.Name()
+		}
+		astutil.DeleteNamedImport(fset, file, name, r.Path)
+
+		buf := &bytes.Buffer{}
+		if err := format.Node(buf, fset, file); err != nil {
+			return nil, err
+		}
+		src = buf.Bytes()
+	}
+
+	return format.Source(src)
+}
+
+// Diff returns a unified diff between the old and new contents of a
+// file.
+func Diff(name string, old, new []byte) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(old),
+		B:        splitLines(new),
+		FromFile: name,
+		ToFile:   name,
+		Context:  3,
+	})
+
+	return diff
+}
+
+// splitLines splits source into lines, keeping the line terminators.
+func splitLines(src []byte) []string {
+	lines := strings.SplitAfter(string(src), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
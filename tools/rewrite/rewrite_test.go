@@ -0,0 +1,287 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rewrite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		fn     string
+		name   string
+		result *Rewriter
+	}{
+		{fn: "os.ReadFile", result: &Rewriter{Path: "os", Func: "ReadFile", Name: "osReadFile"}},
+		{fn: "net/http.Get", result: &Rewriter{Path: "net/http", Func: "Get", Name: "httpGet"}},
+		{fn: "os.ReadFile", name: "readFile", result: &Rewriter{Path: "os", Func: "ReadFile", Name: "readFile"}},
+		{fn: "ReadFile"},
+		{fn: ".ReadFile"},
+		{fn: "os."},
+		{fn: "example.com/pkg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fn, func(t *testing.T) {
+			result, err := New(test.fn, test.name)
+
+			if test.result == nil {
+				assert.ErrorIs(t, err, ErrBadFunc)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.result, result)
+		})
+	}
+}
+
+func loadModule(t *testing.T, files map[string]string) *packages.Package {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/pkg\n\ngo 1.22\n"), 0o600))
+	for name, src := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600))
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: LoadMode, Dir: dir}, ".")
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	require.Empty(t, pkgs[0].Errors)
+
+	return pkgs[0]
+}
+
+func relative(t *testing.T, files map[string][]byte) map[string]string {
+	t.Helper()
+
+	result := map[string]string{}
+	for name, src := range files {
+		result[filepath.Base(name)] = string(src)
+	}
+
+	return result
+}
+
+func TestRewriterPackage(t *testing.T) {
+	pkg := loadModule(t, map[string]string{
+		"a.go": `package pkg
+
+import (
+	"fmt"
+	"os"
+)
+
+// Load loads a file.
+func Load(name string) ([]byte, error) {
+	data, err := os.ReadFile(name) // read the file
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", os.Getenv("PREFIX"), err)
+	}
+
+	return data, nil
+}
+`,
+		"b.go": `package pkg
+
+import "os"
+
+func LoadTwice(name string) ([]byte, error) {
+	if _, err := os.ReadFile(name); err != nil {
+		return nil, err
+	}
+
+	return (os.ReadFile)(name)
+}
+`,
+		"c.go": `package pkg
+
+import (
+	"fmt"
+	xos "os"
+)
+
+func LoadOther(name string) []byte {
+	data, _ := xos.ReadFile(name)
+	fmt.Println("loaded")
+	return data
+}
+`,
+		"d.go": `package pkg
+
+import "os"
+
+func Env() string {
+	return os.Getenv("HOME")
+}
+`,
+		"a_test.go": `package pkg
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	os.ReadFile("x")
+}
+`,
+	})
+	r, err := New("os.ReadFile", "")
+	require.NoError(t, err)
+
+	result, err := r.Package(pkg, os.ReadFile)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"a.go": `package pkg
+
+import (
+	"fmt"
+	"os"
+)
+
+// osReadFile is a patch point for os.ReadFile.
+var osReadFile = os.ReadFile
+
+// Load loads a file.
+func Load(name string) ([]byte, error) {
+	data, err := osReadFile(name) // read the file
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", os.Getenv("PREFIX"), err)
+	}
+
+	return data, nil
+}
+`,
+		"b.go": `package pkg
+
+func LoadTwice(name string) ([]byte, error) {
+	if _, err := osReadFile(name); err != nil {
+		return nil, err
+	}
+
+	return (osReadFile)(name)
+}
+`,
+		"c.go": `package pkg
+
+import (
+	"fmt"
+)
+
+func LoadOther(name string) []byte {
+	data, _ := osReadFile(name)
+	fmt.Println("loaded")
+	return data
+}
+`,
+	}, relative(t, result))
+}
+
+func TestRewriterPackageExisting(t *testing.T) {
+	pkg := loadModule(t, map[string]string{
+		"a.go": `package pkg
+
+import "os"
+
+var readFile = os.ReadFile
+
+func Load(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+`,
+	})
+	r, err := New("os.ReadFile", "readFile")
+	require.NoError(t, err)
+
+	result, err := r.Package(pkg, os.ReadFile)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"a.go": `package pkg
+
+import "os"
+
+var readFile = os.ReadFile
+
+func Load(name string) ([]byte, error) {
+	return readFile(name)
+}
+`,
+	}, relative(t, result))
+}
+
+func TestRewriterPackageConflict(t *testing.T) {
+	pkg := loadModule(t, map[string]string{
+		"a.go": `package pkg
+
+import "os"
+
+var osReadFile = 5
+
+func Load(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+`,
+	})
+	r, err := New("os.ReadFile", "")
+	require.NoError(t, err)
+
+	result, err := r.Package(pkg, os.ReadFile)
+
+	assert.ErrorIs(t, err, ErrNameConflict)
+	assert.Nil(t, result)
+}
+
+func TestRewriterPackageNoCalls(t *testing.T) {
+	pkg := loadModule(t, map[string]string{
+		"a.go": "package pkg\n\nimport \"os\"\n\nvar getenv = os.Getenv\n",
+	})
+	r, err := New("os.ReadFile", "")
+	require.NoError(t, err)
+
+	result, err := r.Package(pkg, os.ReadFile)
+
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestRewriterPackageReadFails(t *testing.T) {
+	pkg := loadModule(t, map[string]string{
+		"a.go": "package pkg\n\nimport \"os\"\n\nvar data, _ = os.ReadFile(\"x\")\n",
+	})
+	r, err := New("os.ReadFile", "")
+	require.NoError(t, err)
+
+	result, err := r.Package(pkg, func(string) ([]byte, error) {
+		return nil, assert.AnError
+	})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, result)
+}
+
+func TestDiff(t *testing.T) {
+	result := Diff("a.go", []byte("a\nb\nc\n"), []byte("a\nB\nc\n"))
+
+	assert.Equal(t, "--- a.go\n+++ a.go\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n", result)
+}